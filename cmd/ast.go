@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"needle/internal/needle/parser"
+	"needle/internal/pkg"
+	"reflect"
+)
+
+// astValue converts AST to value encodable as json, nodes become
+// objects with their type, span and fields named in snake case
+func astValue(node parser.Node) any {
+	return jsonValue(reflect.ValueOf(node))
+}
+
+func jsonValue(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return jsonValue(v.Elem())
+	case reflect.Struct:
+		return jsonStruct(v)
+	case reflect.Slice:
+		list := make([]any, v.Len())
+		for i := range v.Len() {
+			list[i] = jsonValue(v.Index(i))
+		}
+		return list
+	case reflect.Map:
+		// class members are keyed by identifier nodes
+		obj := map[string]any{}
+		iter := v.MapRange()
+		for iter.Next() {
+			obj[fmt.Sprint(iter.Key().Interface())] = jsonValue(iter.Value())
+		}
+		return obj
+	default:
+		return v.Interface()
+	}
+}
+
+func jsonStruct(v reflect.Value) map[string]any {
+	t := v.Type()
+	obj := map[string]any{}
+	if v.CanAddr() {
+		if node, ok := v.Addr().Interface().(parser.Node); ok {
+			obj["type"] = t.Name()
+			obj["span"] = jsonValue(reflect.ValueOf(node.Span()))
+		}
+	}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Anonymous || !field.IsExported() ||
+			field.Tag.Get("json") == "-" {
+			continue
+		}
+		obj[pkg.SnakeCase(field.Name)] = jsonValue(v.Field(i))
+	}
+	return obj
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	exitOK    = 0
+	exitError = 1 // invalid script or runtime error
+	exitUsage = 2
+)
+
+const usage = `usage: ndl [command] [arguments]
+
+commands:
+  run FILE [ARGS...]    run script, ARGS are available as args array
+  check FILE...         report parse and resolve errors
+  tokens [-json] FILE   print lexemes
+  ast [-json] FILE      print syntax tree
+  bytecode FILE         print code compiled for vm backend
+  repl                  start interactive session
+  help                  print this message
+
+ndl FILE [ARGS...] is short for ndl run, ndl without arguments starts repl
+`
+
+var errUsage = errors.New("usage")
+
+// Main runs command line args (without program name), returns exit code
+func Main(args []string) int {
+	err := dispatch(args)
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errUsage):
+		io.WriteString(os.Stderr, usage)
+		return exitUsage
+	default:
+		io.WriteString(os.Stderr, err.Error()+"\n")
+		return exitError
+	}
+}
+
+func dispatch(args []string) error {
+	if len(args) == 0 {
+		return RunRepl()
+	}
+	command, rest := args[0], args[1:]
+	switch command {
+	case "run":
+		if len(rest) == 0 {
+			return errUsage
+		}
+		return RunFile(rest[0], rest[1:])
+	case "check":
+		if len(rest) == 0 {
+			return errUsage
+		}
+		var errs []error
+		for _, file := range rest {
+			errs = append(errs, CheckFile(file))
+		}
+		return errors.Join(errs...)
+	case "tokens":
+		file, asJSON, err := dumpArgs(command, rest)
+		if err != nil {
+			return err
+		}
+		return PrintTokens(file, asJSON)
+	case "ast":
+		file, asJSON, err := dumpArgs(command, rest)
+		if err != nil {
+			return err
+		}
+		return PrintAST(file, asJSON)
+	case "bytecode":
+		if len(rest) != 1 {
+			return errUsage
+		}
+		return PrintBytecode(rest[0])
+	case "repl":
+		return RunRepl()
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return nil
+	}
+	return RunFile(command, rest)
+}
+
+// FILE with optional -json flag of debug dump commands
+func dumpArgs(command string, args []string) (string, bool, error) {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	asJSON := flags.Bool("json", false, "print as json")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return "", false, errUsage
+	}
+	return flags.Arg(0), *asJSON, nil
+}
@@ -1,29 +1,88 @@
 package cmd
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"needle/internal/needle/evaluator"
 	"needle/internal/needle/lexer"
 	"needle/internal/needle/parser"
+	"needle/internal/needle/resolver"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
-	"time"
 )
 
-func RunFile(filePath string) error {
-	source, err := os.ReadFile(filePath)
-	if err != nil {
-		log.Fatal("read file: ", err)
+const (
+	envSearchPath = "NEEDLE_PATH"
+	envBackend    = "NEEDLE_BACKEND"
+)
+
+// directories listed in NEEDLE_PATH environment variable
+func searchPath() []string {
+	return filepath.SplitList(os.Getenv(envSearchPath))
+}
+
+// backend named in NEEDLE_BACKEND environment variable, tree by default
+func backend() evaluator.Backend {
+	if evaluator.Backend(os.Getenv(envBackend)) == evaluator.BACKEND_VM {
+		return evaluator.BACKEND_VM
+	}
+	return evaluator.BACKEND_TREE
+}
+
+// evaluator with every builtin module, fs is confined to working directory
+func newEvaluator(args []string) (*evaluator.Evaluator, error) {
+	ev := evaluator.New()
+	modules := evaluator.PROFILE_FULL
+	if err := ev.SetFSRoot("."); err != nil {
+		modules = slices.DeleteFunc(slices.Clone(modules), func(name string) bool {
+			return name == evaluator.MODULE_FS
+		})
+	}
+	if err := ev.LoadModules(modules...); err != nil {
+		return nil, fmt.Errorf("load modules: %w", err)
 	}
+	ev.SetSearchPath(searchPath())
+	ev.SetBackend(backend())
+	ev.SetArgs(args)
+	return ev, nil
+}
 
-	fmt.Println("== Source ==")
-	fmt.Println(strings.TrimSpace(string(source)))
+// RunFile runs script with args, only script output goes to stdout
+func RunFile(filePath string, args []string) error {
+	ev, err := newEvaluator(args)
+	if err != nil {
+		return err
+	}
+	script, err := loadScript(filePath, ev.Defined)
+	if err != nil {
+		return err
+	}
+	if err := ev.Run(script); err != nil {
+		return fmt.Errorf("runtime error: %w", err)
+	}
+	return nil
+}
 
-	lx := lexer.New([]rune(string(source)))
+// CheckFile reports parse and resolve errors without running script
+func CheckFile(filePath string) error {
+	ev, err := newEvaluator(nil)
+	if err != nil {
+		return err
+	}
+	_, err = loadScript(filePath, ev.Defined)
+	return err
+}
 
-	fmt.Println("== Lexemes ==")
+// PrintTokens prints lexemes of script as table or json
+func PrintTokens(filePath string, asJSON bool) error {
+	source, err := readSource(filePath)
+	if err != nil {
+		return err
+	}
+	lx := lexer.New([]rune(source))
 	var lexemes []*lexer.Lexeme
 	for {
 		lexeme := lx.NextLexeme()
@@ -32,34 +91,92 @@ func RunFile(filePath string) error {
 			break
 		}
 	}
+	if asJSON {
+		return printJSON(lexemes)
+	}
 	lexer.PrintLexemes(lexemes)
-	lx.Reset()
+	return nil
+}
 
-	p := parser.New(lx)
-	script, errs := p.Parse()
+// PrintAST prints parsed script as source-like text or json
+func PrintAST(filePath string, asJSON bool) error {
+	source, err := readSource(filePath)
+	if err != nil {
+		return err
+	}
+	script, errs := parser.New(lexer.New([]rune(source))).Parse()
 	if errs != nil {
-		for _, err := range errs {
-			fmt.Printf("parse error: %s\n", err)
-		}
-		fmt.Println(script)
-		return errors.New("error")
+		return diagnostics(filePath, "parse error", errs)
+	}
+	script.File = filePath
+	if asJSON {
+		return printJSON(astValue(script))
 	}
-	fmt.Println("== AST ==")
 	fmt.Println(strings.TrimSpace(script.String()))
+	return nil
+}
 
-	ev := evaluator.New()
-	evaluator.LoadBuiltins(ev)
-	fmt.Println("== Output ==")
-	start := time.Now()
-	err = ev.Run(script)
+// PrintBytecode prints script compiled for vm backend
+func PrintBytecode(filePath string) error {
+	ev, err := newEvaluator(nil)
+	if err != nil {
+		return err
+	}
+	script, err := loadScript(filePath, ev.Defined)
+	if err != nil {
+		return err
+	}
+	code, err := evaluator.Compile(script)
+	if err != nil {
+		return fmt.Errorf("compile error: %w", err)
+	}
+	fmt.Println(strings.TrimSpace(code.String()))
+	return nil
+}
+
+// parses and resolves script, known reports predefined globals
+func loadScript(
+	filePath string,
+	known func(name string) bool,
+) (*parser.Script, error) {
+	source, err := readSource(filePath)
+	if err != nil {
+		return nil, err
+	}
+	script, errs := parser.New(lexer.New([]rune(source))).Parse()
+	if errs != nil {
+		return nil, diagnostics(filePath, "parse error", errs)
+	}
+	script.File = filePath
+	script.Source = source
+	if errs := resolver.New(known).Resolve(script); errs != nil {
+		return nil, diagnostics(filePath, "resolve error", errs)
+	}
+	return script, nil
+}
+
+func readSource(filePath string) (string, error) {
+	source, err := os.ReadFile(filePath)
 	if err != nil {
-		message := fmt.Sprintf("runtime error: %s\n", err)
-		fmt.Print(message)
-		return errors.New(message)
+		return "", fmt.Errorf("read file: %w", err)
 	}
+	return string(source), nil
+}
 
-	fmt.Println("== Results ==")
-	fmt.Printf("program ends in %v", time.Since(start))
+// joins errors into one, each on own line prefixed with file and kind
+func diagnostics(filePath, kind string, errs []error) error {
+	wrapped := make([]error, len(errs))
+	for i, err := range errs {
+		wrapped[i] = fmt.Errorf("%s: %s: %w", filePath, kind, err)
+	}
+	return errors.Join(wrapped...)
+}
 
+func printJSON(value any) error {
+	out, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
 	return nil
 }
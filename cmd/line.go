@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const historyLimit = 1000
+
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads input lines, on terminal with cursor movement and
+// history recall, otherwise plain lines
+type lineReader struct {
+	in          *bufio.Reader
+	out         io.Writer
+	fd          int
+	interactive bool
+	history     []string
+	historyFile string
+}
+
+func newLineReader(in *os.File, out io.Writer) *lineReader {
+	interactive := false
+	if info, err := in.Stat(); err == nil {
+		interactive = info.Mode()&os.ModeCharDevice != 0
+	}
+	return &lineReader{
+		in:          bufio.NewReader(in),
+		out:         out,
+		fd:          int(in.Fd()),
+		interactive: interactive,
+	}
+}
+
+// ReadLine reads line without line ending, prompt is shown only on
+// terminal, returns io.EOF at end of input and errInterrupted on ctrl+c
+func (lr *lineReader) ReadLine(prompt string) (string, error) {
+	if !lr.interactive {
+		return lr.readPlain()
+	}
+	restore, err := makeRaw(lr.fd)
+	if err != nil {
+		fmt.Fprint(lr.out, prompt)
+		return lr.readPlain()
+	}
+	defer restore()
+	return lr.edit(prompt)
+}
+
+func (lr *lineReader) readPlain() (string, error) {
+	line, err := lr.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func ctrl(key rune) rune {
+	return key & 0x1f
+}
+
+// edits line in raw mode, keys follow readline defaults
+func (lr *lineReader) edit(prompt string) (string, error) {
+	var line []rune
+	pos := 0
+	recall := len(lr.history)
+	draft := ""
+
+	refresh := func() {
+		fmt.Fprintf(lr.out, "\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - pos; back > 0 {
+			fmt.Fprintf(lr.out, "\x1b[%dD", back)
+		}
+	}
+	// shows history entry, index past last entry shows edited line
+	show := func(index int) {
+		if index < 0 || index > len(lr.history) {
+			return
+		}
+		if recall == len(lr.history) {
+			draft = string(line)
+		}
+		recall = index
+		if index == len(lr.history) {
+			line = []rune(draft)
+		} else {
+			line = []rune(lr.history[index])
+		}
+		pos = len(line)
+	}
+	insert := func(rs ...rune) {
+		line = slices.Insert(line, pos, rs...)
+		pos += len(rs)
+	}
+
+	refresh()
+	for {
+		r, _, err := lr.in.ReadRune()
+		if err != nil {
+			fmt.Fprint(lr.out, "\r\n")
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(lr.out, "\r\n")
+			return string(line), nil
+		case ctrl('C'):
+			fmt.Fprint(lr.out, "^C\r\n")
+			return "", errInterrupted
+		case ctrl('D'):
+			if len(line) == 0 {
+				fmt.Fprint(lr.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = slices.Delete(line, pos, pos+1)
+			}
+		case 127, ctrl('H'):
+			if pos > 0 {
+				line = slices.Delete(line, pos-1, pos)
+				pos--
+			}
+		case '\t':
+			insert(' ', ' ', ' ', ' ')
+		case ctrl('A'):
+			pos = 0
+		case ctrl('E'):
+			pos = len(line)
+		case ctrl('B'):
+			pos = max(pos-1, 0)
+		case ctrl('F'):
+			pos = min(pos+1, len(line))
+		case ctrl('K'):
+			line = line[:pos]
+		case ctrl('U'):
+			line = slices.Delete(line, 0, pos)
+			pos = 0
+		case ctrl('W'):
+			start := pos
+			for start > 0 && line[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && line[start-1] != ' ' {
+				start--
+			}
+			line = slices.Delete(line, start, pos)
+			pos = start
+		case ctrl('L'):
+			fmt.Fprint(lr.out, "\x1b[H\x1b[2J")
+		case ctrl('P'):
+			show(recall - 1)
+		case ctrl('N'):
+			show(recall + 1)
+		case '\x1b':
+			switch lr.escape() {
+			case "A":
+				show(recall - 1)
+			case "B":
+				show(recall + 1)
+			case "C":
+				pos = min(pos+1, len(line))
+			case "D":
+				pos = max(pos-1, 0)
+			case "H", "1~", "7~":
+				pos = 0
+			case "F", "4~", "8~":
+				pos = len(line)
+			case "3~":
+				if pos < len(line) {
+					line = slices.Delete(line, pos, pos+1)
+				}
+			}
+		default:
+			if unicode.IsPrint(r) {
+				insert(r)
+			}
+		}
+		refresh()
+	}
+}
+
+// reads rest of escape sequence, returns its final part like "A" for
+// up arrow or "3~" for delete
+func (lr *lineReader) escape() string {
+	r, _, err := lr.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return ""
+	}
+	var seq strings.Builder
+	for {
+		r, _, err := lr.in.ReadRune()
+		if err != nil {
+			return ""
+		}
+		seq.WriteRune(r)
+		if r < '0' || r > '9' {
+			return seq.String()
+		}
+	}
+}
+
+// loadHistory reads history from file, later lines are appended to it
+func (lr *lineReader) loadHistory(path string) {
+	lr.historyFile = path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	lr.history = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lr.history) > historyLimit {
+		lr.history = lr.history[len(lr.history)-historyLimit:]
+		os.WriteFile(path, []byte(strings.Join(lr.history, "\n")+"\n"), 0o600)
+	}
+}
+
+// addHistory remembers line unless it is blank or repeats previous one
+func (lr *lineReader) addHistory(line string) {
+	if strings.TrimSpace(line) == "" ||
+		len(lr.history) > 0 && lr.history[len(lr.history)-1] == line {
+		return
+	}
+	lr.history = append(lr.history, line)
+	if lr.historyFile == "" {
+		return
+	}
+	file, err := os.OpenFile(
+		lr.historyFile,
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+		0o600,
+	)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, line)
+}
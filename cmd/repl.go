@@ -1,24 +1,236 @@
 package cmd
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
-	"needle/internal/needle"
+	"io"
+	"needle/internal/needle/evaluator"
+	"needle/internal/needle/lexer"
+	"needle/internal/needle/parser"
+	"needle/internal/needle/resolver"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
+const envHistory = "NEEDLE_HISTORY"
+
+const replHelp = `commands:
+  :help        print this message
+  :load FILE   run script in current session
+  :reset       forget everything defined in session
+  :ast CODE    print syntax tree of code
+  :env         list global variables
+  :quit        leave repl, same as ctrl+d
+
+unfinished input continues on next line, empty line ends it
+value of expression statement is printed and kept in _
+`
+
+// result of last expression statement
+const lastValue = "_"
+
+type repl struct {
+	ev     *evaluator.Evaluator
+	lines  *lineReader
+	inputs int
+}
+
+// RunRepl reads and runs input until end of input or :quit
 func RunRepl() error {
-	fmt.Println("Needle ver0.0.1")
-	fmt.Println("exit using ctrl+c")
-	n := needle.New()
-	needle.LoadBuiltin(n)
+	r := &repl{lines: newLineReader(os.Stdin, os.Stdout)}
+	if r.lines.interactive {
+		r.lines.loadHistory(historyPath())
+		fmt.Println("Needle ver0.0.1")
+		fmt.Println("type :help for help, exit using ctrl+d")
+	}
+	if err := r.reset(); err != nil {
+		return err
+	}
+	for {
+		input, err := r.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !r.run(input) {
+			return nil
+		}
+	}
+}
+
+// history file named in NEEDLE_HISTORY, ~/.ndl_history by default,
+// empty NEEDLE_HISTORY disables history file
+func historyPath() string {
+	if path, ok := os.LookupEnv(envHistory); ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ndl_history")
+}
+
+// replaces evaluator, keeping old one when new one fails to load
+func (r *repl) reset() error {
+	ev, err := newEvaluator(nil)
+	if err != nil {
+		return err
+	}
+	r.ev = ev
+	r.ev.SetGlobal(lastValue, &evaluator.Null{})
+	return nil
+}
+
+// reads lines until input parses or fails before its end
+func (r *repl) read() (string, error) {
+	prompt := "> "
+	input := ""
 	for {
-		fmt.Print("> ")
-		r := bufio.NewReader(os.Stdin)
-		str, _ := r.ReadString('\n')
-		err := n.RunString(str[:len(str)-2])
+		line, err := r.lines.ReadLine(prompt)
+		if errors.Is(err, errInterrupted) {
+			prompt, input = "> ", ""
+			continue
+		}
+		if err == io.EOF && input != "" {
+			return input, nil
+		}
 		if err != nil {
-			fmt.Println(err)
+			return "", err
+		}
+		if r.lines.interactive {
+			r.lines.addHistory(line)
+		}
+		blank := strings.TrimSpace(line) == ""
+		switch {
+		case input == "" && blank:
+			continue
+		case input == "":
+			input = line
+		case blank:
+			return input, nil
+		default:
+			input += "\n" + line
+		}
+		if strings.HasPrefix(strings.TrimSpace(input), ":") {
+			return input, nil
 		}
+		if _, errs := parse(input); !incomplete(errs) {
+			return input, nil
+		}
+		prompt = "... "
+	}
+}
+
+// parses input, expression statement may omit final semicolon
+func parse(input string) (*parser.Script, []error) {
+	script, errs := parser.New(lexer.New([]rune(input))).Parse()
+	if incomplete(errs) {
+		withSemicolon, semicolonErrs := parser.New(
+			lexer.New([]rune(input + ";")),
+		).Parse()
+		if semicolonErrs == nil {
+			script, errs = withSemicolon, nil
+		}
+	}
+	if script != nil {
+		script.Source = input
+	}
+	return script, errs
+}
+
+// reports whether parsing stopped at end of input
+func incomplete(errs []error) bool {
+	var err *parser.Error
+	return len(errs) > 0 && errors.As(errs[0], &err) && err.AtEOF
+}
+
+// runs input, returns false to leave repl
+func (r *repl) run(input string) bool {
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, ":") {
+		r.eval(input)
+		return true
+	}
+	command, arg, _ := strings.Cut(input[1:], " ")
+	arg = strings.TrimSpace(arg)
+	switch command {
+	case "help":
+		fmt.Print(replHelp)
+	case "load":
+		if arg == "" {
+			report(errors.New("usage: :load FILE"))
+			break
+		}
+		script, err := loadScript(arg, r.ev.Defined)
+		if err == nil {
+			err = r.ev.Run(script)
+		}
+		report(err)
+	case "reset":
+		report(r.reset())
+	case "ast":
+		script, errs := parse(arg)
+		if errs != nil {
+			report(diagnostics("<repl>", "parse error", errs))
+			break
+		}
+		fmt.Println(strings.TrimSpace(script.String()))
+	case "env":
+		for _, name := range r.ev.Globals() {
+			value, _ := r.ev.Global(name)
+			fmt.Printf("%s = %s\n", name, value.Say())
+		}
+	case "quit", "exit", "q":
+		return false
+	default:
+		report(fmt.Errorf("unknown command ':%s', type :help", command))
+	}
+	return true
+}
+
+// runs code in session, value of final expression statement is
+// assigned to _ and printed unless it is null
+func (r *repl) eval(input string) {
+	// inputs are named apart so that traces of functions defined
+	// earlier point into their own source
+	r.inputs++
+	name := fmt.Sprintf("<repl %d>", r.inputs)
+	script, errs := parse(input)
+	if errs != nil {
+		report(diagnostics(name, "parse error", errs))
+		return
+	}
+	script.File = name
+	show := false
+	if last := len(script.Statements) - 1; last >= 0 {
+		if stmt, ok := script.Statements[last].(*parser.ExpressionStatement); ok {
+			script.Statements[last] = &parser.AssignmentStatement{
+				Location: stmt.Location,
+				Left:     &parser.IdentifierLiteral{Value: lastValue},
+				Right:    stmt.Expression,
+			}
+			show = true
+		}
+	}
+	if errs := resolver.New(r.ev.Defined).Resolve(script); errs != nil {
+		report(diagnostics(name, "resolve error", errs))
+		return
+	}
+	if err := r.ev.Run(script); err != nil {
+		report(fmt.Errorf("runtime error: %w", err))
+		return
+	}
+	if value, _ := r.ev.Global(lastValue); show && value.Type() != evaluator.VAL_NULL {
+		fmt.Println(value.Say())
+	}
+}
+
+func report(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 	}
 }
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package cmd
+
+import "errors"
+
+// makeRaw is not supported, repl falls back to lines edited by terminal
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.ErrUnsupported
+}
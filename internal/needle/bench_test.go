@@ -0,0 +1,45 @@
+package needle_test
+
+import (
+	"bytes"
+	"testing"
+)
+
+// loop inside function keeps its variables in local slots, global loop
+// goes through named globals, both call a native function per step
+var loopScripts = map[string]string{
+	"local": `
+var run = fun(n) {
+    var sum = 0;
+    for (var i = 0; i < n; i = i + 1) {
+        sum = sum + math.abs(i % 7 - 3) * 2;
+    }
+    return sum;
+};
+say run(100000);
+`,
+	"global": `
+var sum = 0;
+for (var i = 0; i < 100000; i = i + 1) {
+    sum = sum + math.abs(i % 7 - 3) * 2;
+}
+say sum;
+`,
+}
+
+func BenchmarkLoop(b *testing.B) {
+	for _, backend := range backends {
+		for _, scope := range []string{"local", "global"} {
+			b.Run(string(backend)+"/"+scope, func(b *testing.B) {
+				for b.Loop() {
+					var out bytes.Buffer
+					n := newNeedle(&out)
+					n.SetBackend(backend)
+					if err := n.RunString(loopScripts[scope]); err != nil {
+						b.Fatalf("unexpected error: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
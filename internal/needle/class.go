@@ -0,0 +1,144 @@
+package needle
+
+import (
+	"errors"
+	"fmt"
+	"needle/internal/needle/evaluator"
+	"reflect"
+)
+
+// ClassBuilder describes native class whose instances wrap Go value of
+// type T, constructors return it, methods, getters and setters receive
+// it as first parameter, other parameters and results are converted like
+// in NewFunction
+type ClassBuilder[T any] struct {
+	class *evaluator.Class
+	errs  []error
+}
+
+// NewClass starts native class named name
+func NewClass[T any](name string) *ClassBuilder[T] {
+	return &ClassBuilder[T]{
+		class: &evaluator.Class{
+			Name:         name,
+			Fields:       map[string]evaluator.Value{},
+			Constructors: map[string]*evaluator.Function{},
+			Public:       map[string]*evaluator.Function{},
+			Private:      map[string]*evaluator.Function{},
+			Getters:      map[string]*evaluator.Function{},
+			Setters:      map[string]*evaluator.Function{},
+		},
+	}
+}
+
+// Constructor adds constructor called as Class.name(...), f returns
+// wrapped value and optionally error
+func (b *ClassBuilder[T]) Constructor(name string, f any) *ClassBuilder[T] {
+	g, err := newGoFunc(f, 0)
+	if err == nil && (g.results != 1 || g.ft.Out(0) != reflect.TypeFor[T]()) {
+		err = fmt.Errorf("expected func returning %s, got %s", reflect.TypeFor[T](), g.ft)
+	}
+	if b.check("constructor", name, err) {
+		b.class.Constructors[name] = b.native(name, func(
+			e *evaluator.Evaluator,
+			this evaluator.Value,
+			args ...evaluator.Value,
+		) evaluator.Value {
+			this.(*evaluator.Instance).Host = g.call(e, nil, args)[0].Interface()
+			return this
+		})
+	}
+	return b
+}
+
+// Method adds public method, f receives wrapped value first
+func (b *ClassBuilder[T]) Method(name string, f any) *ClassBuilder[T] {
+	if native, ok := b.bound("method", name, f, -1); ok {
+		b.class.Public[name] = native
+	}
+	return b
+}
+
+// Getter adds property read as instance.name, f is func(T) R
+func (b *ClassBuilder[T]) Getter(name string, f any) *ClassBuilder[T] {
+	if native, ok := b.bound("getter", name, f, 0); ok {
+		b.class.Getters[name] = native
+	}
+	return b
+}
+
+// Setter adds property assigned as instance.name = value, f is
+// func(T, V) with optional error result
+func (b *ClassBuilder[T]) Setter(name string, f any) *ClassBuilder[T] {
+	if native, ok := b.bound("setter", name, f, 1); ok {
+		b.class.Setters[name] = native
+	}
+	return b
+}
+
+// Build returns class or all errors of its description
+func (b *ClassBuilder[T]) Build() (*evaluator.Class, error) {
+	if b.errs != nil {
+		return nil, errors.Join(b.errs...)
+	}
+	return b.class, nil
+}
+
+// wraps f taking receiver, params is required argument count or -1
+func (b *ClassBuilder[T]) bound(
+	kind, name string,
+	f any,
+	params int,
+) (*evaluator.Function, bool) {
+	g, err := newGoFunc(f, 1)
+	host := reflect.TypeFor[T]()
+	switch {
+	case err != nil:
+	case g.ft.In(0) != host:
+		err = fmt.Errorf("expected receiver %s, got %s", host, g.ft)
+	case params >= 0 && (g.fixed != params || g.ft.IsVariadic()):
+		err = fmt.Errorf("expected %d parameters after receiver, got %s", params, g.ft)
+	case kind == "getter" && g.results != 1:
+		err = fmt.Errorf("expected func with one result, got %s", g.ft)
+	}
+	if !b.check(kind, name, err) {
+		return nil, false
+	}
+	className := b.class.Name
+	return b.native(name, func(
+		e *evaluator.Evaluator,
+		this evaluator.Value,
+		args ...evaluator.Value,
+	) evaluator.Value {
+		instance, _ := this.(*evaluator.Instance)
+		if instance == nil || instance.Host == nil {
+			e.ThrowException("%s.%s needs constructed instance", className, name)
+		}
+		receiver := reflect.ValueOf(instance.Host)
+		return g.value(e, g.call(e, []reflect.Value{receiver}, args))
+	}), true
+}
+
+func (b *ClassBuilder[T]) native(
+	name string,
+	f evaluator.NativeFunction,
+) *evaluator.Function {
+	return &evaluator.Function{
+		FType:  evaluator.F_NATIVE,
+		Name:   b.class.Name + "." + name,
+		Native: f,
+	}
+}
+
+// records error of member, reports whether member is valid
+func (b *ClassBuilder[T]) check(kind, name string, err error) bool {
+	if err != nil {
+		b.errs = append(b.errs, fmt.Errorf("%s.%s: %s: %w", b.class.Name, name, kind, err))
+	}
+	return err == nil
+}
+
+// LoadClass declares class visible to script and its modules
+func (n *Needle) LoadClass(class *evaluator.Class) {
+	n.ev.SetBuiltin(class.Name, class)
+}
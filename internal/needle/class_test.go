@@ -0,0 +1,158 @@
+package needle_test
+
+import (
+	"bytes"
+	"errors"
+	"needle/internal/needle"
+	"needle/internal/needle/evaluator"
+	"strings"
+	"testing"
+)
+
+type counter struct {
+	n int
+}
+
+func (c *counter) Add(by int) int {
+	c.n += by
+	return c.n
+}
+
+func counterClass(t *testing.T) *evaluator.Class {
+	class, err := needle.NewClass[*counter]("Counter").
+		Constructor("new", func(start int) *counter {
+			return &counter{n: start}
+		}).
+		Method("add", (*counter).Add).
+		Getter("value", func(c *counter) int { return c.n }).
+		Setter("value", func(c *counter, n int) error {
+			if n < 0 {
+				return errors.New("negative value")
+			}
+			c.n = n
+			return nil
+		}).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return class
+}
+
+func TestNativeClass(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, n *needle.Needle) {
+		var out bytes.Buffer
+		n.SetOutput(&out)
+		n.LoadClass(counterClass(t))
+		err := n.RunString(`
+var c = Counter.new(1);
+c.add(2);
+say c.value;
+c.value = 10;
+say c.add(1);
+say Counter.new(5).value;
+try { c.value = -1; } catch (e) { say e.message(); }
+try { c.add("x"); } catch (e) { say e.message(); }
+`)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := `3
+11
+5
+"negative value"
+"argument 1: cannot convert string to int"
+`
+		if out.String() != want {
+			t.Errorf("wrong output:\n%s", out.String())
+		}
+	})
+}
+
+func TestNativeClassErrors(t *testing.T) {
+	_, err := needle.NewClass[*counter]("Counter").
+		Constructor("new", func() int { return 0 }).
+		Method("add", func(c counter) {}).
+		Getter("value", func(c *counter, x int) int { return 0 }).
+		Build()
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	for _, member := range []string{"Counter.new", "Counter.add", "Counter.value"} {
+		if !strings.Contains(err.Error(), member) {
+			t.Errorf("error does not mention %s: %v", member, err)
+		}
+	}
+}
+
+func TestNativeClassInheritance(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, n *needle.Needle) {
+		var out bytes.Buffer
+		n.SetOutput(&out)
+		n.LoadClass(counterClass(t))
+		err := n.RunString(`
+var Stepper = class extends Counter {
+    var step = 1;
+    constructor new(start, step) {
+        super.new(start);
+        this.step = step;
+    }
+    public tick() { return this.add(this.step); }
+};
+var s = Stepper.new(1, 5);
+say s.tick();
+say s.value;
+say instance_of(s, Counter);
+`)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := `6
+6
+true
+`
+		if out.String() != want {
+			t.Errorf("wrong output:\n%s", out.String())
+		}
+	})
+}
+
+func TestNativeSpreadArgs(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, n *needle.Needle) {
+		var out bytes.Buffer
+		n.SetOutput(&out)
+		n.LoadClass(counterClass(t))
+		n.LoadFunctionParams("span", func(
+			e *evaluator.Evaluator,
+			this evaluator.Value,
+			args ...evaluator.Value,
+		) evaluator.Value {
+			from := args[0].(*evaluator.Number).Value
+			to := args[1].(*evaluator.Number).Value
+			return &evaluator.Number{Value: to - from}
+		}, evaluator.Param{Name: "from"}, evaluator.Param{Name: "to", Default: &evaluator.Number{Value: 10}})
+		err := n.RunString(`
+say math.max(...array{1, 5, 3});
+say string.format("{}-{}", ...array{"a", "b"});
+say Counter.new(...array{2}).add(...array{3});
+say span(...array{4});
+say span(to = 7, from = 2);
+say span(...array{1}, to = 3);
+try { math.max(1, by = 2); } catch (e) { say e.message(); }
+`)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := `5
+"a-b"
+5
+6
+5
+2
+"unknown argument 'by'"
+`
+		if out.String() != want {
+			t.Errorf("wrong output:\n%s", out.String())
+		}
+	})
+}
@@ -0,0 +1,620 @@
+package needle
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"needle/internal/needle/evaluator"
+	"needle/internal/pkg"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// struct tag naming field as seen by scripts, "-" hides field, untagged
+// exported fields are named in snake case
+const tagName = "needle"
+
+var (
+	valueType = reflect.TypeFor[evaluator.Value]()
+	errorType = reflect.TypeFor[error]()
+)
+
+// ToValue converts Go value to script value: bools, numbers and strings
+// to their script counterparts, slices and arrays to Array, maps to Table,
+// structs to Instance of class generated for struct type, funcs to native
+// functions and nil to null, script values are returned as is, cyclic
+// values are an error
+func ToValue(v any) (evaluator.Value, error) {
+	return toValue(reflect.ValueOf(v), newConverter(nil))
+}
+
+// pointer, map or slice being converted, meeting one again below
+// itself means Go value is cyclic
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// state of single conversion, evaluator is nil outside of native calls
+type converter struct {
+	e    *evaluator.Evaluator
+	seen map[visit]bool
+}
+
+func newConverter(e *evaluator.Evaluator) *converter {
+	return &converter{e: e, seen: map[visit]bool{}}
+}
+
+// marks reference v as being converted, caller deletes it when done
+func (c *converter) enter(v reflect.Value) (visit, error) {
+	key := visit{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		key.len = v.Len()
+	}
+	if c.seen[key] {
+		return key, fmt.Errorf("cannot convert cyclic %s", v.Type())
+	}
+	c.seen[key] = true
+	return key, nil
+}
+
+// sets pair through hash protocol of evaluator, without one keys
+// hashed by script cannot be placed where scripts would look for them
+func (c *converter) set(tbl *evaluator.Table, key, value evaluator.Value) error {
+	if c.e != nil {
+		return c.e.SetPair(tbl, key, value)
+	}
+	if instance, ok := key.(*evaluator.Instance); ok {
+		if _, ok := instance.Class.Public["hash"]; ok {
+			return fmt.Errorf("class %s hashes keys by script, convert it in native call", instance.Class.Name)
+		}
+	}
+	_, err := tbl.Pairs.Set(key, value)
+	return err
+}
+
+func toValue(v reflect.Value, c *converter) (evaluator.Value, error) {
+	if !v.IsValid() {
+		return &evaluator.Null{}, nil
+	}
+	if v.Type().Implements(valueType) {
+		if isNil(v) {
+			return &evaluator.Null{}, nil
+		}
+		return v.Interface().(evaluator.Value), nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return &evaluator.Boolean{Value: v.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &evaluator.Number{Value: float64(v.Int())}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return &evaluator.Number{Value: float64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &evaluator.Number{Value: v.Float()}, nil
+	case reflect.String:
+		return &evaluator.String{Value: v.String()}, nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return &evaluator.Null{}, nil
+		}
+		return toValue(v.Elem(), c)
+	case reflect.Pointer:
+		if v.IsNil() {
+			return &evaluator.Null{}, nil
+		}
+		key, err := c.enter(v)
+		if err != nil {
+			return nil, err
+		}
+		defer delete(c.seen, key)
+		return toValue(v.Elem(), c)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Len() > 0 {
+			key, err := c.enter(v)
+			if err != nil {
+				return nil, err
+			}
+			defer delete(c.seen, key)
+		}
+		arr := &evaluator.Array{Elements: make([]evaluator.Value, v.Len())}
+		for i := range v.Len() {
+			elem, err := toValue(v.Index(i), c)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			arr.Elements[i] = elem
+		}
+		return arr, nil
+	case reflect.Map:
+		key, err := c.enter(v)
+		if err != nil {
+			return nil, err
+		}
+		defer delete(c.seen, key)
+		return mapToTable(v, c)
+	case reflect.Struct:
+		return structToInstance(v, c)
+	case reflect.Func:
+		if v.IsNil() {
+			return &evaluator.Null{}, nil
+		}
+		return NewFunction(v.Interface())
+	}
+	return nil, fmt.Errorf("cannot convert %s to needle value", v.Type())
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice,
+		reflect.Func:
+		return v.IsNil()
+	}
+	return false
+}
+
+// map keys are sorted so that tables of equal maps iterate alike
+func mapToTable(v reflect.Value, c *converter) (evaluator.Value, error) {
+	keys := v.MapKeys()
+	slices.SortFunc(keys, compareKeys)
+	tbl := &evaluator.Table{Pairs: evaluator.NewHashTable()}
+	for _, key := range keys {
+		k, err := toValue(key, c)
+		if err != nil {
+			return nil, err
+		}
+		value, err := toValue(v.MapIndex(key), c)
+		if err != nil {
+			return nil, fmt.Errorf("[%v]: %w", key.Interface(), err)
+		}
+		if err := c.set(tbl, k, value); err != nil {
+			return nil, fmt.Errorf("map key %s: %w", key.Type(), err)
+		}
+	}
+	return tbl, nil
+}
+
+// numeric keys sort by value before other keys, which sort as printed
+func compareKeys(a, b reflect.Value) int {
+	x, xNumber := keyNumber(a)
+	y, yNumber := keyNumber(b)
+	switch {
+	case xNumber && yNumber:
+		return cmp.Compare(x, y)
+	case xNumber:
+		return -1
+	case yNumber:
+		return 1
+	}
+	return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+}
+
+func keyNumber(v reflect.Value) (float64, bool) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+type structField struct {
+	name  string
+	index []int
+}
+
+// exported fields of struct type with names seen by scripts
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for _, field := range reflect.VisibleFields(t) {
+		if field.Anonymous || !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get(tagName), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = pkg.SnakeCase(field.Name)
+		}
+		fields = append(fields, structField{name: name, index: field.Index})
+	}
+	return fields
+}
+
+var structClasses = struct {
+	sync.Mutex
+	byType map[reflect.Type]*evaluator.Class
+}{byType: map[reflect.Type]*evaluator.Class{}}
+
+// class of converted structs, fields are exposed as getters, one class
+// per struct type
+func structClass(t reflect.Type) *evaluator.Class {
+	structClasses.Lock()
+	defer structClasses.Unlock()
+	if class, ok := structClasses.byType[t]; ok {
+		return class
+	}
+	name := t.Name()
+	if name == "" {
+		name = t.String()
+	}
+	class := &evaluator.Class{
+		Name:         name,
+		Fields:       map[string]evaluator.Value{},
+		Constructors: map[string]*evaluator.Function{},
+		Public:       map[string]*evaluator.Function{},
+		Private:      map[string]*evaluator.Function{},
+		Getters:      map[string]*evaluator.Function{},
+		Setters:      map[string]*evaluator.Function{},
+	}
+	for _, field := range structFields(t) {
+		class.Getters[field.name] = &evaluator.Function{
+			FType: evaluator.F_NATIVE,
+			Name:  name + "." + field.name,
+			Native: func(
+				e *evaluator.Evaluator,
+				this evaluator.Value,
+				args ...evaluator.Value,
+			) evaluator.Value {
+				return this.(*evaluator.Instance).Fields[field.name]
+			},
+		}
+	}
+	structClasses.byType[t] = class
+	return class
+}
+
+func structToInstance(v reflect.Value, c *converter) (evaluator.Value, error) {
+	instance := &evaluator.Instance{
+		Class:  structClass(v.Type()),
+		Fields: map[string]evaluator.Value{},
+	}
+	for _, field := range structFields(v.Type()) {
+		fv, err := v.FieldByIndexErr(field.index)
+		if err != nil {
+			// field promoted through nil embedded pointer
+			instance.Fields[field.name] = &evaluator.Null{}
+			continue
+		}
+		value, err := toValue(fv, c)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.name, err)
+		}
+		instance.Fields[field.name] = value
+	}
+	return instance, nil
+}
+
+// FromValue stores script value into Go variable target points to,
+// reversing ToValue, structs are also filled from tables keyed by field
+// names and any receives bool, float64, string, []any, map[any]any,
+// map[string]any for instances or script value itself
+func FromValue(value evaluator.Value, target any) error {
+	ptr := reflect.ValueOf(target)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() {
+		return fmt.Errorf("target must be non-nil pointer, got %T", target)
+	}
+	return fromValue(value, ptr.Elem())
+}
+
+func fromValue(value evaluator.Value, dst reflect.Value) error {
+	t := dst.Type()
+	if value == nil {
+		value = &evaluator.Null{}
+	}
+	// script values go as is unless target is any
+	if reflect.TypeOf(value).AssignableTo(t) &&
+		(t.Kind() != reflect.Interface || t.NumMethod() > 0) {
+		dst.Set(reflect.ValueOf(value))
+		return nil
+	}
+	if _, ok := value.(*evaluator.Null); ok && isNil(reflect.Zero(t)) {
+		dst.SetZero()
+		return nil
+	}
+	mismatch := fmt.Errorf("cannot convert %s to %s", typeName(value), t)
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(t.Elem())
+		if err := fromValue(value, elem.Elem()); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			return mismatch
+		}
+		if natural := goValue(value); natural != nil {
+			dst.Set(reflect.ValueOf(natural))
+		} else {
+			dst.SetZero()
+		}
+		return nil
+	}
+
+	switch value := value.(type) {
+	case *evaluator.Boolean:
+		if t.Kind() == reflect.Bool {
+			dst.SetBool(value.Value)
+			return nil
+		}
+	case *evaluator.Number:
+		return numberTo(value.Value, dst, mismatch)
+	case *evaluator.String:
+		if t.Kind() == reflect.String {
+			dst.SetString(value.Value)
+			return nil
+		}
+	case *evaluator.Array:
+		return arrayTo(value, dst, mismatch)
+	case *evaluator.Table:
+		switch t.Kind() {
+		case reflect.Map:
+			return tableToMap(value, dst)
+		case reflect.Struct:
+			fields := map[string]evaluator.Value{}
+			for _, pair := range value.Pairs.Entries() {
+				if key, ok := pair.Key.(*evaluator.String); ok {
+					fields[key.Value] = pair.Value
+				}
+			}
+			return fieldsToStruct(fields, dst)
+		}
+	case *evaluator.Instance:
+		if t.Kind() == reflect.Struct {
+			return fieldsToStruct(value.Fields, dst)
+		}
+	}
+	return mismatch
+}
+
+func numberTo(n float64, dst reflect.Value, mismatch error) error {
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n != math.Trunc(n) || dst.OverflowInt(int64(n)) {
+			return fmt.Errorf("%g does not fit %s", n, dst.Type())
+		}
+		dst.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		if n != math.Trunc(n) || n < 0 || dst.OverflowUint(uint64(n)) {
+			return fmt.Errorf("%g does not fit %s", n, dst.Type())
+		}
+		dst.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		dst.SetFloat(n)
+	default:
+		return mismatch
+	}
+	return nil
+}
+
+func arrayTo(arr *evaluator.Array, dst reflect.Value, mismatch error) error {
+	switch dst.Kind() {
+	case reflect.Slice:
+		dst.Set(reflect.MakeSlice(dst.Type(), len(arr.Elements), len(arr.Elements)))
+	case reflect.Array:
+		if dst.Len() != len(arr.Elements) {
+			return fmt.Errorf(
+				"cannot convert array of %d elements to %s",
+				len(arr.Elements),
+				dst.Type(),
+			)
+		}
+	default:
+		return mismatch
+	}
+	for i, elem := range arr.Elements {
+		if err := fromValue(elem, dst.Index(i)); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func tableToMap(tbl *evaluator.Table, dst reflect.Value) error {
+	t := dst.Type()
+	m := reflect.MakeMapWithSize(t, tbl.Pairs.Size())
+	for _, pair := range tbl.Pairs.Entries() {
+		key := reflect.New(t.Key()).Elem()
+		if err := fromValue(pair.Key, key); err != nil {
+			return fmt.Errorf("key %s: %w", pair.Key.Say(), err)
+		}
+		value := reflect.New(t.Elem()).Elem()
+		if err := fromValue(pair.Value, value); err != nil {
+			return fmt.Errorf("[%s]: %w", pair.Key.Say(), err)
+		}
+		m.SetMapIndex(key, value)
+	}
+	dst.Set(m)
+	return nil
+}
+
+// missing fields keep their values
+func fieldsToStruct(fields map[string]evaluator.Value, dst reflect.Value) error {
+	for _, field := range structFields(dst.Type()) {
+		value, ok := fields[field.name]
+		if !ok {
+			continue
+		}
+		fv, err := dst.FieldByIndexErr(field.index)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field.name, err)
+		}
+		if err := fromValue(value, fv); err != nil {
+			return fmt.Errorf("%s: %w", field.name, err)
+		}
+	}
+	return nil
+}
+
+// Go value of script value when target type is any
+func goValue(value evaluator.Value) any {
+	switch value := value.(type) {
+	case *evaluator.Null:
+		return nil
+	case *evaluator.Boolean:
+		return value.Value
+	case *evaluator.Number:
+		return value.Value
+	case *evaluator.String:
+		return value.Value
+	case *evaluator.Array:
+		list := make([]any, len(value.Elements))
+		for i, elem := range value.Elements {
+			list[i] = goValue(elem)
+		}
+		return list
+	case *evaluator.Table:
+		m := make(map[any]any, value.Pairs.Size())
+		for _, pair := range value.Pairs.Entries() {
+			m[goValue(pair.Key)] = goValue(pair.Value)
+		}
+		return m
+	case *evaluator.Instance:
+		m := make(map[string]any, len(value.Fields))
+		for name, field := range value.Fields {
+			m[name] = goValue(field)
+		}
+		return m
+	}
+	return value
+}
+
+// name of script value type for conversion errors
+func typeName(value evaluator.Value) string {
+	switch value := value.(type) {
+	case *evaluator.Instance:
+		if value.Class.Name != "" {
+			return "instance of " + value.Class.Name
+		}
+		return "instance"
+	case *evaluator.Class:
+		return "class"
+	}
+	return string(value.Type())
+}
+
+// NewFunction wraps Go func as native function, arguments are converted
+// with FromValue and checked against parameter types, results with
+// ToValue, several results become array and non-nil error returned last
+// is thrown as exception
+func NewFunction(f any) (*evaluator.Function, error) {
+	g, err := newGoFunc(f, 0)
+	if err != nil {
+		return nil, err
+	}
+	native := func(
+		e *evaluator.Evaluator,
+		this evaluator.Value,
+		args ...evaluator.Value,
+	) evaluator.Value {
+		return g.value(e, g.call(e, nil, args))
+	}
+	return &evaluator.Function{FType: evaluator.F_NATIVE, Native: native}, nil
+}
+
+// Go func called from scripts, leading bound parameters (like receiver
+// of native class method) are passed by host
+type goFunc struct {
+	fv           reflect.Value
+	ft           reflect.Type
+	bound        int
+	fixed        int // parameters after bound ones without variadic one
+	results      int // results without trailing error
+	returnsError bool
+}
+
+func newGoFunc(f any, bound int) (*goFunc, error) {
+	fv := reflect.ValueOf(f)
+	if fv.Kind() != reflect.Func || fv.IsNil() {
+		return nil, fmt.Errorf("expected func, got %T", f)
+	}
+	ft := fv.Type()
+	g := &goFunc{fv: fv, ft: ft, bound: bound, fixed: ft.NumIn() - bound}
+	if ft.IsVariadic() {
+		g.fixed--
+	}
+	if g.fixed < 0 {
+		return nil, fmt.Errorf("expected func with %d leading parameters, got %s", bound, ft)
+	}
+	g.results = ft.NumOut()
+	if g.results > 0 && ft.Out(g.results-1) == errorType {
+		g.returnsError = true
+		g.results--
+	}
+	return g, nil
+}
+
+// checks and converts args, calls func after bound values and throws
+// error it returns, returns other results
+func (g *goFunc) call(
+	e *evaluator.Evaluator,
+	bound []reflect.Value,
+	args []evaluator.Value,
+) []reflect.Value {
+	switch {
+	case g.ft.IsVariadic() && len(args) < g.fixed:
+		e.ThrowException(
+			"expected at least %d arguments, got %d",
+			g.fixed,
+			len(args),
+		)
+	case !g.ft.IsVariadic() && len(args) != g.fixed:
+		e.ThrowException("expected %d arguments, got %d", g.fixed, len(args))
+	}
+	in := append(bound, make([]reflect.Value, len(args))...)
+	for i, arg := range args {
+		var t reflect.Type
+		if i < g.fixed {
+			t = g.ft.In(g.bound + i)
+		} else {
+			t = g.ft.In(g.ft.NumIn() - 1).Elem()
+		}
+		v := reflect.New(t).Elem()
+		if err := fromValue(arg, v); err != nil {
+			e.ThrowException("argument %d: %s", i+1, err)
+		}
+		in[g.bound+i] = v
+	}
+	out := g.fv.Call(in)
+	if g.returnsError {
+		if err, _ := out[g.results].Interface().(error); err != nil {
+			e.ThrowException("%s", err)
+		}
+	}
+	return out[:g.results]
+}
+
+// converts results, no result is null and several become array
+func (g *goFunc) value(e *evaluator.Evaluator, out []reflect.Value) evaluator.Value {
+	values := make([]evaluator.Value, len(out))
+	for i, result := range out {
+		value, err := toValue(result, newConverter(e))
+		if err != nil {
+			e.ThrowException("result %d: %s", i+1, err)
+		}
+		values[i] = value
+	}
+	switch len(values) {
+	case 0:
+		return &evaluator.Null{}
+	case 1:
+		return values[0]
+	}
+	return &evaluator.Array{Elements: values}
+}
@@ -0,0 +1,210 @@
+package needle_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"needle/internal/needle"
+	"needle/internal/needle/evaluator"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type address struct {
+	City string
+}
+
+type user struct {
+	Name    string
+	UserID  int
+	Tags    []string
+	Scores  map[string]float64
+	Home    *address
+	Secret  string `needle:"-"`
+	Renamed bool   `needle:"active"`
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	in := user{
+		Name:    "lin",
+		UserID:  7,
+		Tags:    []string{"a", "b"},
+		Scores:  map[string]float64{"x": 1.5},
+		Home:    &address{City: "kyiv"},
+		Secret:  "hidden",
+		Renamed: true,
+	}
+	value, err := needle.ToValue(in)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	instance, ok := value.(*evaluator.Instance)
+	if !ok {
+		t.Fatalf("expected instance, got %s", value.Say())
+	}
+	if _, ok := instance.Fields["secret"]; ok {
+		t.Errorf("hidden field converted")
+	}
+	if _, ok := instance.Fields["user_id"]; !ok {
+		t.Errorf("missing snake case field")
+	}
+
+	var out user
+	if err := needle.FromValue(value, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	in.Secret = ""
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip mismatch: %+v", out)
+	}
+}
+
+func TestFromValueErrors(t *testing.T) {
+	var n int
+	err := needle.FromValue(&evaluator.Number{Value: 1.5}, &n)
+	if err == nil {
+		t.Errorf("expected error for fractional int")
+	}
+
+	var list []int
+	value, _ := needle.ToValue([]any{1, "two"})
+	err = needle.FromValue(value, &list)
+	if err == nil || !strings.HasPrefix(err.Error(), "[1]: ") {
+		t.Errorf("expected element error, got %v", err)
+	}
+
+	var anything any
+	value, _ = needle.ToValue(map[string]any{"k": []int{1}})
+	if err := needle.FromValue(value, &anything); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[any]any{"k": []any{1.0}}
+	if !reflect.DeepEqual(anything, want) {
+		t.Errorf("wrong any value %#v", anything)
+	}
+}
+
+type node struct {
+	Name string
+	Next *node
+}
+
+func TestToValueCycle(t *testing.T) {
+	loop := &node{Name: "a"}
+	loop.Next = &node{Name: "b", Next: loop}
+	list := []any{1, nil}
+	list[1] = list
+	table := map[string]any{}
+	table["self"] = table
+	for _, v := range []any{loop, list, table} {
+		_, err := needle.ToValue(v)
+		if err == nil || !strings.Contains(err.Error(), "cannot convert cyclic") {
+			t.Errorf("%T: expected cycle error, got %v", v, err)
+		}
+	}
+
+	// shared but acyclic values convert each time they are met
+	shared := &node{Name: "shared"}
+	value, err := needle.ToValue([]*node{shared, shared})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(value.(*evaluator.Array).Elements) != 2 {
+		t.Errorf("wrong value %s", value.Say())
+	}
+}
+
+func TestGoFunction(t *testing.T) {
+	var out bytes.Buffer
+	n := newNeedle(&out)
+	err := n.LoadGoFunction("scale", func(x int, unit string) (float64, error) {
+		if x < 0 {
+			return 0, errors.New("negative size")
+		}
+		return float64(x) * 2.5, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	n.LoadGoFunction("greet", func(u user) string {
+		return fmt.Sprintf("%s:%d", u.Name, u.UserID)
+	})
+	n.LoadGoFunction("find", func(id int) *user {
+		return &user{Name: "ann", UserID: id}
+	})
+
+	err = n.RunString(`
+say scale(2, "cm");
+say greet(table{["name"] = "bob", ["user_id"] = 3});
+say find(4).name;
+try { scale(-1, "cm"); } catch (e) { say e.message(); }
+try { scale("2", "cm"); } catch (e) { say e.message(); }
+try { scale(1); } catch (e) { say e.message(); }
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `5
+"bob:3"
+"ann"
+"negative size"
+"argument 1: cannot convert string to int"
+"expected 2 arguments, got 1"
+`
+	if out.String() != want {
+		t.Errorf("wrong output:\n%s", out.String())
+	}
+
+	if err := n.LoadGoFunction("bad", 42); err == nil {
+		t.Errorf("expected error for non-func")
+	}
+}
+
+func TestGoMapHashedKeys(t *testing.T) {
+	var out bytes.Buffer
+	n := newNeedle(&out)
+	n.LoadGoFunction("wrap", func(key evaluator.Value) map[evaluator.Value]int {
+		return map[evaluator.Value]int{key: 7}
+	})
+	err := n.RunString(`
+var Point = class {
+    public var x;
+    constructor new(x) { this.x = x; }
+    public hash() { return this.x; }
+    public equals(other) { return this.x == other.x; }
+};
+var t = wrap(Point.new(1));
+say t[Point.new(1)];
+var d = json.decode("{\"a\": 1, \"a\": 2}");
+say d.size();
+say d["a"];
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "7\n1\n2\n" {
+		t.Errorf("wrong output:\n%s", out.String())
+	}
+
+	point, _ := n.GetGlobal("t")
+	key := point.(*evaluator.Table).Pairs.Entries()[0].Key
+	_, err = needle.ToValue(map[evaluator.Value]int{key: 1})
+	if err == nil || !strings.Contains(err.Error(), "hashes keys by script") {
+		t.Errorf("expected hashed key error, got %v", err)
+	}
+}
+
+func TestMapKeyOrder(t *testing.T) {
+	value, err := needle.ToValue(map[any]int{10: 0, 2: 0, "b": 0, 1.5: 0, "a": 0, 1: 0})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var keys []string
+	for _, entry := range value.(*evaluator.Table).Pairs.Entries() {
+		keys = append(keys, entry.Key.Say())
+	}
+	if got := strings.Join(keys, " "); got != `1 1.5 2 10 "a" "b"` {
+		t.Errorf("wrong key order %s", got)
+	}
+}
@@ -2,29 +2,15 @@ package evaluator
 
 import (
 	"fmt"
-	"math/rand/v2"
-	"time"
 )
 
+// NativeFunction implements function in Go, args may share memory with
+// vm stack, so function keeping them after return must copy them
 type NativeFunction func(e *Evaluator, this Value, args ...Value) Value
 
-func LoadBuiltins(e *Evaluator) {
-	for name, builtin := range newBuiltins() {
-		fun := &Function{
-			FType:  F_NATIVE,
-			Native: builtin,
-		}
-		e.env.Declare(name, fun)
-	}
-}
-
-func newBuiltins() map[string]NativeFunction {
-	builtins := map[string]NativeFunction{
-		"clock":    coverNative(builtin_clock, 0),
-		"class_of": coverNative(builtin_class_of, 1),
-		"random":   coverNative(builtin_random, 0),
-	}
-	return builtins
+// LoadBuiltins declares modules of pure profile
+func LoadBuiltins(e *Evaluator) error {
+	return e.LoadModules(PROFILE_PURE...)
 }
 
 func CheckArgsLength(length int, args []Value) error {
@@ -41,6 +27,38 @@ func CheckArgsLength(length int, args []Value) error {
 	return nil
 }
 
+// Param describes native function parameter, Default is used when
+// argument is omitted and must be set for every parameter after first
+// optional one, Rest parameter receives remaining arguments as array
+type Param struct {
+	Name    string
+	Default Value
+	Rest    bool
+}
+
+// NewNative creates function binding positional, named and spread
+// arguments to params the same way script functions do
+func NewNative(f NativeFunction, params ...Param) *Function {
+	fun := &Function{
+		FType:          F_NATIVE,
+		Native:         f,
+		Parameters:     []string{},
+		NativeDefaults: []Value{},
+	}
+	for _, param := range params {
+		if param.Rest {
+			fun.Rest = true
+			break
+		}
+		if param.Default == nil && len(fun.Parameters) == fun.Required {
+			fun.Required++
+		}
+		fun.Parameters = append(fun.Parameters, param.Name)
+		fun.NativeDefaults = append(fun.NativeDefaults, param.Default)
+	}
+	return fun
+}
+
 func coverNative(f NativeFunction, a int) NativeFunction {
 	return func(
 		e *Evaluator,
@@ -54,20 +72,3 @@ func coverNative(f NativeFunction, a int) NativeFunction {
 		return f(e, this, args...)
 	}
 }
-
-func builtin_clock(e *Evaluator, this Value, args ...Value) Value {
-	t := float64(time.Now().UnixNano()) / float64(time.Second)
-	return &Number{Value: t}
-}
-
-func builtin_class_of(e *Evaluator, this Value, args ...Value) Value {
-	if instance, ok := args[0].(*Instance); ok {
-		return instance.Class
-	}
-	return &Null{}
-}
-
-func builtin_random(e *Evaluator, this Value, args ...Value) Value {
-	r := rand.Float64()
-	return &Number{Value: r}
-}
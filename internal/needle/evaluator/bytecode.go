@@ -0,0 +1,258 @@
+package evaluator
+
+import (
+	"fmt"
+	"needle/internal/needle/parser"
+	"slices"
+	"strings"
+)
+
+type Opcode byte
+
+// operands are big-endian uint16 unless noted
+const (
+	OP_CONSTANT Opcode = iota // const index
+	OP_NULL
+	OP_TRUE
+	OP_FALSE
+	OP_POP
+	OP_DUP
+	OP_SWAP
+
+	OP_GET_NAME  // name index
+	OP_SET_NAME  // name index
+	OP_DECLARE   // name index
+	OP_GET_LOCAL // depth, index
+	OP_SET_LOCAL // depth, index
+	OP_THIS
+	OP_SUPER       // name index
+	OP_ENTER_SCOPE // slot count
+	OP_EXIT_SCOPE
+
+	OP_BINARY // operator index
+	OP_UNARY  // operator index
+
+	OP_JUMP          // address
+	OP_JUMP_IF_FALSE // address
+	OP_JUMP_IF_TRUE  // address
+	OP_ITER
+	OP_ITER_NEXT // exit address, variable count
+
+	OP_CALL      // argument count
+	OP_CALL_ARGS // const index of named argument names
+	OP_APPEND
+	OP_SPREAD
+	OP_DEFAULT       // parameter slot, address to skip default
+	OP_GET_PROP      // name index
+	OP_GET_THIS_PROP // name index
+	OP_SET_PROP      // name index
+	OP_SET_THIS_PROP // name index
+	OP_GET_INDEX
+	OP_SET_INDEX
+	OP_SLICE
+
+	OP_CLOSURE // function index
+	OP_CLASS   // class index
+	OP_ARRAY   // element count
+	OP_TABLE   // pair count
+	OP_CONCAT  // part count
+
+	OP_SAY
+	OP_RETURN
+	OP_THROW
+	OP_RETHROW
+	OP_SETUP_TRY // handler address
+	OP_POP_TRY
+	OP_MATCH_EXC
+	OP_CAUGHT
+	OP_ERROR // const index of message
+
+	OP_IMPORT // import index
+	OP_EXPORT // name index
+)
+
+type opDef struct {
+	name     string
+	operands int
+}
+
+var opDefs = map[Opcode]opDef{
+	OP_CONSTANT: {"CONSTANT", 1},
+	OP_NULL:     {"NULL", 0},
+	OP_TRUE:     {"TRUE", 0},
+	OP_FALSE:    {"FALSE", 0},
+	OP_POP:      {"POP", 0},
+	OP_DUP:      {"DUP", 0},
+	OP_SWAP:     {"SWAP", 0},
+
+	OP_GET_NAME:    {"GET_NAME", 1},
+	OP_SET_NAME:    {"SET_NAME", 1},
+	OP_DECLARE:     {"DECLARE", 1},
+	OP_GET_LOCAL:   {"GET_LOCAL", 2},
+	OP_SET_LOCAL:   {"SET_LOCAL", 2},
+	OP_THIS:        {"THIS", 0},
+	OP_SUPER:       {"SUPER", 1},
+	OP_ENTER_SCOPE: {"ENTER_SCOPE", 1},
+	OP_EXIT_SCOPE:  {"EXIT_SCOPE", 0},
+
+	OP_BINARY: {"BINARY", 1},
+	OP_UNARY:  {"UNARY", 1},
+
+	OP_JUMP:          {"JUMP", 1},
+	OP_JUMP_IF_FALSE: {"JUMP_IF_FALSE", 1},
+	OP_JUMP_IF_TRUE:  {"JUMP_IF_TRUE", 1},
+	OP_ITER:          {"ITER", 0},
+	OP_ITER_NEXT:     {"ITER_NEXT", 2},
+
+	OP_CALL:          {"CALL", 1},
+	OP_CALL_ARGS:     {"CALL_ARGS", 1},
+	OP_APPEND:        {"APPEND", 0},
+	OP_SPREAD:        {"SPREAD", 0},
+	OP_DEFAULT:       {"DEFAULT", 2},
+	OP_GET_PROP:      {"GET_PROP", 1},
+	OP_GET_THIS_PROP: {"GET_THIS_PROP", 1},
+	OP_SET_PROP:      {"SET_PROP", 1},
+	OP_SET_THIS_PROP: {"SET_THIS_PROP", 1},
+	OP_GET_INDEX:     {"GET_INDEX", 0},
+	OP_SET_INDEX:     {"SET_INDEX", 0},
+	OP_SLICE:         {"SLICE", 0},
+
+	OP_CLOSURE: {"CLOSURE", 1},
+	OP_CLASS:   {"CLASS", 1},
+	OP_ARRAY:   {"ARRAY", 1},
+	OP_TABLE:   {"TABLE", 1},
+	OP_CONCAT:  {"CONCAT", 1},
+
+	OP_SAY:       {"SAY", 0},
+	OP_RETURN:    {"RETURN", 0},
+	OP_THROW:     {"THROW", 0},
+	OP_RETHROW:   {"RETHROW", 0},
+	OP_SETUP_TRY: {"SETUP_TRY", 1},
+	OP_POP_TRY:   {"POP_TRY", 0},
+	OP_MATCH_EXC: {"MATCH_EXC", 0},
+	OP_CAUGHT:    {"CAUGHT", 0},
+	OP_ERROR:     {"ERROR", 1},
+
+	OP_IMPORT: {"IMPORT", 1},
+	OP_EXPORT: {"EXPORT", 1},
+}
+
+// operators addressed by OP_BINARY and OP_UNARY
+var codeOperators = []parser.Operator{
+	parser.OP_PLUS,
+	parser.OP_MINUS,
+	parser.OP_STAR,
+	parser.OP_SLASH,
+	parser.OP_PERCENT,
+	parser.OP_POWER,
+	parser.OP_EQ,
+	parser.OP_NE,
+	parser.OP_IS,
+	parser.OP_ISNT,
+	parser.OP_LT,
+	parser.OP_LE,
+	parser.OP_GT,
+	parser.OP_GE,
+	parser.OP_OR,
+	parser.OP_AND,
+	parser.OP_NOT,
+}
+
+// compiled function or script body
+type Code struct {
+	Name         string
+	Instructions []byte
+	Spans        []CodeSpan
+	Constants    []Value
+	Names        []string
+	Functions    []*Code
+	Classes      []*ClassTemplate
+	Imports      []*parser.ImportStatement
+	Parameters   []string
+	Required     int
+	Rest         bool
+	Slots        int
+}
+
+// maps instruction offset to source span of node it executes,
+// sorted by offset
+type CodeSpan struct {
+	Offset int
+	Span   parser.Span
+}
+
+// finds span of last recorded instruction before ip
+func (c *Code) span(ip int) parser.Span {
+	i, _ := slices.BinarySearchFunc(
+		c.Spans,
+		ip,
+		func(s CodeSpan, ip int) int { return s.Offset - ip },
+	)
+	if i == 0 {
+		return parser.Span{}
+	}
+	return c.Spans[i-1].Span
+}
+
+// describes values popped by OP_CLASS, in order, parent comes first
+type ClassTemplate struct {
+	Name         string
+	Parent       bool
+	Fields       []string
+	PublicFields []string
+	Constructors []string
+	Public       []string
+	Private      []string
+	Getters      []string
+	Setters      []string
+}
+
+func (c *Code) String() string {
+	var str strings.Builder
+	c.disassemble(&str, "")
+	return str.String()
+}
+
+func (c *Code) disassemble(str *strings.Builder, indent string) {
+	for ip := 0; ip < len(c.Instructions); {
+		op := Opcode(c.Instructions[ip])
+		def := opDefs[op]
+		fmt.Fprintf(str, "%s%04d %-14s", indent, ip, def.name)
+		ip++
+		if def.operands == 2 {
+			fmt.Fprintf(
+				str,
+				" %d %d",
+				readOperand(c.Instructions, ip),
+				readOperand(c.Instructions, ip+2),
+			)
+			ip += 4
+		}
+		if def.operands == 1 {
+			operand := readOperand(c.Instructions, ip)
+			ip += 2
+			fmt.Fprintf(str, " %d", operand)
+			switch op {
+			case OP_CONSTANT, OP_ERROR:
+				fmt.Fprintf(str, " (%s)", c.Constants[operand].Say())
+			case OP_GET_NAME, OP_SET_NAME, OP_DECLARE, OP_GET_PROP,
+				OP_GET_THIS_PROP, OP_SET_PROP, OP_SET_THIS_PROP, OP_EXPORT,
+				OP_SUPER:
+				fmt.Fprintf(str, " (%s)", c.Names[operand])
+			case OP_BINARY, OP_UNARY:
+				fmt.Fprintf(str, " (%s)", codeOperators[operand])
+			case OP_IMPORT:
+				fmt.Fprintf(str, " (%s)", c.Imports[operand].Path)
+			}
+		}
+		str.WriteByte('\n')
+		if op == OP_CLOSURE {
+			operand := readOperand(c.Instructions, ip-2)
+			c.Functions[operand].disassemble(str, indent+"    ")
+		}
+	}
+}
+
+func readOperand(code []byte, ip int) int {
+	return int(code[ip])<<8 | int(code[ip+1])
+}
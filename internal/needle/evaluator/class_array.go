@@ -0,0 +1,320 @@
+package evaluator
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// methods of Array class, callbacks get element and index, sort and
+// reverse change array in place, other methods return new arrays
+func arrayMethods() map[string]*Function {
+	return map[string]*Function{
+		"push":       native(arr_push, 1),
+		"pop":        native(arr_pop, 0),
+		"length":     native(arr_length, 0),
+		"map":        native(arr_map, 1),
+		"filter":     native(arr_filter, 1),
+		"reduce":     native(arr_reduce, -1),
+		"for_each":   native(arr_for_each, 1),
+		"find":       native(arr_find, 1),
+		"find_index": native(arr_find_index, 1),
+		"some":       native(arr_some, 1),
+		"every":      native(arr_every, 1),
+		"sort": NewNative(
+			arr_sort,
+			Param{Name: "compare", Default: &Null{}},
+		),
+		"reverse":   native(arr_reverse, 0),
+		"concat":    native(arr_concat, -1),
+		"insert":    native(arr_insert, 2),
+		"remove_at": native(arr_remove_at, 1),
+		"index_of":  native(arr_index_of, 1),
+		"contains":  native(arr_contains, 1),
+		"join": NewNative(
+			arr_join,
+			Param{Name: "separator", Default: &String{Value: ""}},
+		),
+		"flat": NewNative(
+			arr_flat,
+			Param{Name: "depth", Default: &Number{Value: 1}},
+		),
+		"zip": native(arr_zip, 1),
+	}
+}
+
+// calls callback with first required args, further args are passed only
+// to functions declaring parameters for them, so fun(x) and natives like
+// math.abs can be used where element and index are available
+func (e *Evaluator) callback(callee Value, required int, args ...Value) Value {
+	fun, _ := callee.(*Function)
+	if method, ok := callee.(*Method); ok {
+		fun = method.Function
+	}
+	n := required
+	if fun != nil && (fun.Rest || fun.Parameters != nil) {
+		n = max(len(fun.Parameters), required)
+		if fun.Rest {
+			n = len(args)
+		}
+	}
+	return e.callValue(callee, args[:min(n, len(args))])
+}
+
+// index of array, index equal to length is allowed for insertion
+func (e *Evaluator) arrayIndex(args []Value, i int, length int) int {
+	index := e.intArg(args, i)
+	if index < 0 || index > length {
+		e.ThrowException("index out of range")
+	}
+	return index
+}
+
+func arr_push(e *Evaluator, this Value, args ...Value) Value {
+	arr := this.(*Array)
+	arr.Elements = append(arr.Elements, args...)
+	e.alloc(sizeValue)
+	return e.env.globals.Null
+}
+
+func arr_pop(e *Evaluator, this Value, args ...Value) Value {
+	arr := this.(*Array)
+	if len(arr.Elements) == 0 {
+		e.ThrowException("array is empty")
+	}
+	elem := arr.Elements[len(arr.Elements)-1]
+	arr.Elements = arr.Elements[:len(arr.Elements)-1]
+	return elem
+}
+
+func arr_length(e *Evaluator, this Value, args ...Value) Value {
+	return &Number{Value: float64(len(this.(*Array).Elements))}
+}
+
+func arr_map(e *Evaluator, this Value, args ...Value) Value {
+	elems := this.(*Array).Elements
+	result := &Array{Elements: make([]Value, 0, len(elems))}
+	for i := 0; i < len(elems); i++ {
+		value := e.callback(args[0], 1, elems[i], &Number{Value: float64(i)})
+		result.Elements = append(result.Elements, value)
+	}
+	e.alloc(sizeValue * len(result.Elements))
+	return result
+}
+
+func arr_filter(e *Evaluator, this Value, args ...Value) Value {
+	elems := this.(*Array).Elements
+	result := &Array{Elements: []Value{}}
+	for i := 0; i < len(elems); i++ {
+		elem := elems[i]
+		if toBoolean(e.callback(args[0], 1, elem, &Number{Value: float64(i)})) {
+			result.Elements = append(result.Elements, elem)
+		}
+	}
+	e.alloc(sizeValue * len(result.Elements))
+	return result
+}
+
+// folds elements with f(accumulator, element, index), first element is
+// initial accumulator when none is given
+func arr_reduce(e *Evaluator, this Value, args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		e.ThrowException("expected 1 to 2 arguments, got %d", len(args))
+	}
+	elems := this.(*Array).Elements
+	start := 0
+	var acc Value
+	if len(args) == 2 {
+		acc = args[1]
+	} else {
+		if len(elems) == 0 {
+			e.ThrowException("reduce of empty array without initial value")
+		}
+		acc, start = elems[0], 1
+	}
+	for i := start; i < len(elems); i++ {
+		acc = e.callback(args[0], 2, acc, elems[i], &Number{Value: float64(i)})
+	}
+	return acc
+}
+
+func arr_for_each(e *Evaluator, this Value, args ...Value) Value {
+	elems := this.(*Array).Elements
+	for i := 0; i < len(elems); i++ {
+		e.callback(args[0], 1, elems[i], &Number{Value: float64(i)})
+	}
+	return e.env.globals.Null
+}
+
+// index of first element satisfying predicate, -1 when none does
+func (e *Evaluator) findIndex(arr *Array, predicate Value) int {
+	for i := 0; i < len(arr.Elements); i++ {
+		if toBoolean(e.callback(predicate, 1, arr.Elements[i], &Number{Value: float64(i)})) {
+			return i
+		}
+	}
+	return -1
+}
+
+// first element satisfying predicate or null
+func arr_find(e *Evaluator, this Value, args ...Value) Value {
+	arr := this.(*Array)
+	if i := e.findIndex(arr, args[0]); i >= 0 {
+		return arr.Elements[i]
+	}
+	return e.env.globals.Null
+}
+
+func arr_find_index(e *Evaluator, this Value, args ...Value) Value {
+	return &Number{Value: float64(e.findIndex(this.(*Array), args[0]))}
+}
+
+func arr_some(e *Evaluator, this Value, args ...Value) Value {
+	return &Boolean{Value: e.findIndex(this.(*Array), args[0]) >= 0}
+}
+
+func arr_every(e *Evaluator, this Value, args ...Value) Value {
+	elems := this.(*Array).Elements
+	for i := 0; i < len(elems); i++ {
+		if !toBoolean(e.callback(args[0], 1, elems[i], &Number{Value: float64(i)})) {
+			return &Boolean{Value: false}
+		}
+	}
+	return &Boolean{Value: true}
+}
+
+// stable sort in place, compare(a, b) returns negative number when a
+// goes first, without it numbers and strings are sorted ascending
+func arr_sort(e *Evaluator, this Value, args ...Value) Value {
+	arr := this.(*Array)
+	compare := e.compare
+	if _, ok := args[0].(*Null); !ok {
+		compare = func(a, b Value) int {
+			result, ok := e.callback(args[0], 2, a, b).(*Number)
+			if !ok {
+				e.ThrowException("compare must return number")
+			}
+			switch {
+			case result.Value < 0:
+				return -1
+			case result.Value > 0:
+				return 1
+			}
+			return 0
+		}
+	}
+	// callbacks may change array while sorting
+	elems := slices.Clone(arr.Elements)
+	slices.SortStableFunc(elems, compare)
+	arr.Elements = elems
+	return arr
+}
+
+// orders two numbers or two strings
+func (e *Evaluator) compare(a, b Value) int {
+	switch a := a.(type) {
+	case *Number:
+		if b, ok := b.(*Number); ok {
+			return cmp.Compare(a.Value, b.Value)
+		}
+	case *String:
+		if b, ok := b.(*String); ok {
+			return strings.Compare(a.Value, b.Value)
+		}
+	}
+	e.ThrowException("cannot compare %s and %s", a.Type(), b.Type())
+	return 0
+}
+
+// reverses in place
+func arr_reverse(e *Evaluator, this Value, args ...Value) Value {
+	arr := this.(*Array)
+	slices.Reverse(arr.Elements)
+	return arr
+}
+
+// new array of this and given arrays elements
+func arr_concat(e *Evaluator, this Value, args ...Value) Value {
+	elems := slices.Clone(this.(*Array).Elements)
+	for i := range args {
+		elems = append(elems, e.arrayArg(args, i).Elements...)
+	}
+	e.alloc(sizeValue * len(elems))
+	return &Array{Elements: elems}
+}
+
+// inserts value before index, index equal to length appends
+func arr_insert(e *Evaluator, this Value, args ...Value) Value {
+	arr := this.(*Array)
+	index := e.arrayIndex(args, 0, len(arr.Elements))
+	arr.Elements = slices.Insert(arr.Elements, index, args[1])
+	e.alloc(sizeValue)
+	return e.env.globals.Null
+}
+
+// removes element at index and returns it
+func arr_remove_at(e *Evaluator, this Value, args ...Value) Value {
+	arr := this.(*Array)
+	index := e.arrayIndex(args, 0, len(arr.Elements)-1)
+	elem := arr.Elements[index]
+	arr.Elements = slices.Delete(arr.Elements, index, index+1)
+	return elem
+}
+
+// index of first element equal to value, -1 when missing
+func (e *Evaluator) indexOf(arr *Array, value Value) int {
+	return slices.IndexFunc(arr.Elements, func(elem Value) bool {
+		return e.equal(elem, value)
+	})
+}
+
+func arr_index_of(e *Evaluator, this Value, args ...Value) Value {
+	return &Number{Value: float64(e.indexOf(this.(*Array), args[0]))}
+}
+
+func arr_contains(e *Evaluator, this Value, args ...Value) Value {
+	return &Boolean{Value: e.indexOf(this.(*Array), args[0]) >= 0}
+}
+
+// texts of elements with separator between them
+func arr_join(e *Evaluator, this Value, args ...Value) Value {
+	elems := this.(*Array).Elements
+	texts := make([]string, len(elems))
+	for i, elem := range elems {
+		texts[i] = e.text(elem)
+	}
+	return e.newString(strings.Join(texts, e.stringArg(args, 0)))
+}
+
+// new array with nested arrays spread depth levels deep
+func arr_flat(e *Evaluator, this Value, args ...Value) Value {
+	depth := e.intArg(args, 0)
+	if depth < 0 {
+		e.ThrowException("negative depth %d", depth)
+	}
+	elems := flatten([]Value{}, this.(*Array).Elements, depth)
+	e.alloc(sizeValue * len(elems))
+	return &Array{Elements: elems}
+}
+
+func flatten(dst, elems []Value, depth int) []Value {
+	for _, elem := range elems {
+		if inner, ok := elem.(*Array); ok && depth > 0 {
+			dst = flatten(dst, inner.Elements, depth-1)
+			continue
+		}
+		dst = append(dst, elem)
+	}
+	return dst
+}
+
+// pairs of elements at same index, as long as shorter array
+func arr_zip(e *Evaluator, this Value, args ...Value) Value {
+	elems, other := this.(*Array).Elements, e.arrayArg(args, 0).Elements
+	result := &Array{Elements: make([]Value, min(len(elems), len(other)))}
+	for i := range result.Elements {
+		result.Elements[i] = &Array{Elements: []Value{elems[i], other[i]}}
+	}
+	e.alloc(3 * sizeValue * len(result.Elements))
+	return result
+}
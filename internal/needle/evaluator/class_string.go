@@ -0,0 +1,222 @@
+package evaluator
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// methods of String class, indexes and lengths count characters
+func stringMethods() map[string]*Function {
+	return map[string]*Function{
+		"length":        native(str_length, 0),
+		"reverse":       native(str_reverse, 0),
+		"to_upper_case": native(str_to_upper_case, 0),
+		"to_lower_case": native(str_to_lower_case, 0),
+		"to_number":     native(str_to_number, 0),
+		"to_boolean":    native(str_to_boolean, 0),
+		"split": NewNative(
+			str_split,
+			Param{Name: "separator", Default: &Null{}},
+		),
+		"join":        native(str_join, 1),
+		"trim":        native(str_trim, 0),
+		"trim_left":   native(str_trim_left, 0),
+		"trim_right":  native(str_trim_right, 0),
+		"starts_with": native(str_starts_with, 1),
+		"ends_with":   native(str_ends_with, 1),
+		"contains":    native(str_contains, 1),
+		"index_of":    native(str_index_of, 1),
+		"replace":     native(str_replace, 2),
+		"repeat":      native(str_repeat, 1),
+		"pad_left": NewNative(
+			str_pad_left,
+			Param{Name: "width"},
+			Param{Name: "fill", Default: &String{Value: " "}},
+		),
+		"pad_right": NewNative(
+			str_pad_right,
+			Param{Name: "width"},
+			Param{Name: "fill", Default: &String{Value: " "}},
+		),
+		"chars":   native(str_chars, 0),
+		"code_at": native(str_code_at, 1),
+	}
+}
+
+// longest string repeat and padding may build, in bytes
+const maxStringLength = 1 << 30
+
+// new string counted by memory limit
+func (e *Evaluator) newString(s string) *String {
+	e.alloc(len(s))
+	return &String{Value: s}
+}
+
+func str_length(e *Evaluator, this Value, args ...Value) Value {
+	return &Number{Value: float64(utf8.RuneCountInString(this.(*String).Value))}
+}
+
+func str_reverse(e *Evaluator, this Value, args ...Value) Value {
+	rev := []rune(this.(*String).Value)
+	for i := 0; i < len(rev)/2; i++ {
+		alt := len(rev) - i - 1
+		rev[i], rev[alt] = rev[alt], rev[i]
+	}
+	return e.newString(string(rev))
+}
+
+func str_to_upper_case(e *Evaluator, this Value, args ...Value) Value {
+	return e.newString(strings.ToUpper(this.(*String).Value))
+}
+
+func str_to_lower_case(e *Evaluator, this Value, args ...Value) Value {
+	return e.newString(strings.ToLower(this.(*String).Value))
+}
+
+// number written in string, surrounding spaces are allowed
+func str_to_number(e *Evaluator, this Value, args ...Value) Value {
+	str := this.(*String).Value
+	num, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil {
+		e.ThrowException("cannot convert %s to number", strconv.Quote(str))
+	}
+	return &Number{Value: num}
+}
+
+// false for empty string
+func str_to_boolean(e *Evaluator, this Value, args ...Value) Value {
+	return &Boolean{Value: this.(*String).Value != ""}
+}
+
+// parts between separator, null separator splits on runs of spaces,
+// empty one splits into characters
+func str_split(e *Evaluator, this Value, args ...Value) Value {
+	str := this.(*String).Value
+	var parts []string
+	if _, ok := args[0].(*Null); ok {
+		parts = strings.Fields(str)
+	} else {
+		parts = strings.Split(str, e.stringArg(args, 0))
+	}
+	return e.stringArray(parts)
+}
+
+// texts of array elements with this string between them
+func str_join(e *Evaluator, this Value, args ...Value) Value {
+	arr := e.arrayArg(args, 0)
+	texts := make([]string, len(arr.Elements))
+	for i, elem := range arr.Elements {
+		texts[i] = e.text(elem)
+	}
+	return e.newString(strings.Join(texts, this.(*String).Value))
+}
+
+func str_trim(e *Evaluator, this Value, args ...Value) Value {
+	return &String{Value: strings.TrimSpace(this.(*String).Value)}
+}
+
+func str_trim_left(e *Evaluator, this Value, args ...Value) Value {
+	return &String{Value: strings.TrimLeftFunc(this.(*String).Value, unicode.IsSpace)}
+}
+
+func str_trim_right(e *Evaluator, this Value, args ...Value) Value {
+	return &String{Value: strings.TrimRightFunc(this.(*String).Value, unicode.IsSpace)}
+}
+
+func str_starts_with(e *Evaluator, this Value, args ...Value) Value {
+	return &Boolean{Value: strings.HasPrefix(this.(*String).Value, e.stringArg(args, 0))}
+}
+
+func str_ends_with(e *Evaluator, this Value, args ...Value) Value {
+	return &Boolean{Value: strings.HasSuffix(this.(*String).Value, e.stringArg(args, 0))}
+}
+
+func str_contains(e *Evaluator, this Value, args ...Value) Value {
+	return &Boolean{Value: strings.Contains(this.(*String).Value, e.stringArg(args, 0))}
+}
+
+// character index of first occurrence, -1 when missing
+func str_index_of(e *Evaluator, this Value, args ...Value) Value {
+	str := this.(*String).Value
+	i := strings.Index(str, e.stringArg(args, 0))
+	if i >= 0 {
+		i = utf8.RuneCountInString(str[:i])
+	}
+	return &Number{Value: float64(i)}
+}
+
+// replaces every occurrence
+func str_replace(e *Evaluator, this Value, args ...Value) Value {
+	str := this.(*String).Value
+	return e.newString(strings.ReplaceAll(str, e.stringArg(args, 0), e.stringArg(args, 1)))
+}
+
+func str_repeat(e *Evaluator, this Value, args ...Value) Value {
+	str := this.(*String).Value
+	count := e.intArg(args, 0)
+	if count < 0 {
+		e.ThrowException("negative repeat count %d", count)
+	}
+	if count > 0 && len(str) > maxStringLength/count {
+		e.ThrowException("repeat result is too long")
+	}
+	e.alloc(len(str) * count)
+	return &String{Value: strings.Repeat(str, count)}
+}
+
+func str_pad_left(e *Evaluator, this Value, args ...Value) Value {
+	str := this.(*String).Value
+	return e.newString(e.padding(str, args) + str)
+}
+
+func str_pad_right(e *Evaluator, this Value, args ...Value) Value {
+	str := this.(*String).Value
+	return e.newString(str + e.padding(str, args))
+}
+
+// fill repeated to make str width characters long
+func (e *Evaluator) padding(str string, args []Value) string {
+	width := e.intArg(args, 0)
+	fill := []rune(e.stringArg(args, 1))
+	if len(fill) == 0 {
+		e.ThrowException("empty padding")
+	}
+	missing := width - utf8.RuneCountInString(str)
+	if missing <= 0 {
+		return ""
+	}
+	if missing > maxStringLength/utf8.UTFMax {
+		e.ThrowException("padding is too long")
+	}
+	e.alloc(missing * utf8.UTFMax)
+	pad := make([]rune, missing)
+	for i := range pad {
+		pad[i] = fill[i%len(fill)]
+	}
+	return string(pad)
+}
+
+func str_chars(e *Evaluator, this Value, args ...Value) Value {
+	return e.stringArray(strings.Split(this.(*String).Value, ""))
+}
+
+// code point of character at index
+func str_code_at(e *Evaluator, this Value, args ...Value) Value {
+	runes := []rune(this.(*String).Value)
+	i := e.intArg(args, 0)
+	if i < 0 || i >= len(runes) {
+		e.ThrowException("index out of range")
+	}
+	return &Number{Value: float64(runes[i])}
+}
+
+func (e *Evaluator) stringArray(strs []string) *Array {
+	arr := &Array{Elements: make([]Value, len(strs))}
+	for i, str := range strs {
+		arr.Elements[i] = &String{Value: str}
+		e.alloc(sizeValue + len(str))
+	}
+	return arr
+}
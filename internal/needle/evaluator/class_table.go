@@ -0,0 +1,170 @@
+package evaluator
+
+// methods of Table class, pairs keep insertion order
+func tableMethods() map[string]*Function {
+	return map[string]*Function{
+		"size":    native(tbl_size, 0),
+		"delete":  native(tbl_delete, 1),
+		"keys":    native(tbl_keys, 0),
+		"values":  native(tbl_values, 0),
+		"entries": native(tbl_entries, 0),
+		"has":     native(tbl_has, 1),
+		"get": NewNative(
+			tbl_get,
+			Param{Name: "key"},
+			Param{Name: "default", Default: &Null{}},
+		),
+		"merge": native(tbl_merge, -1),
+		"clear": native(tbl_clear, 0),
+		"copy":  native(tbl_copy, 0),
+	}
+}
+
+// hash of instance whose class defines hash and equals methods
+func (e *Evaluator) customHash(key Value) (hashKey, bool) {
+	instance, ok := key.(*Instance)
+	if !ok {
+		return hashKey{}, false
+	}
+	hash, ok := instance.Class.Public["hash"]
+	if !ok {
+		return hashKey{}, false
+	}
+	if _, ok := instance.Class.Public["equals"]; !ok {
+		e.ThrowException("class %s defines hash without equals", instance.Class.Name)
+	}
+	result := e.callValue(&Method{Function: hash, This: instance}, nil)
+	switch result.(type) {
+	case *Boolean, *Number, *String:
+	default:
+		e.ThrowException(
+			"%s.hash must return boolean, number or string, got %s",
+			instance.Class.Name,
+			result.Type(),
+		)
+	}
+	hk, _ := toHashKey(result)
+	return hashKey{VAL_INSTANCE, hk}, true
+}
+
+// compares keys with equal custom hashes
+func (e *Evaluator) keysEqual(a, b Value) bool {
+	instance := a.(*Instance)
+	equals := instance.Class.Public["equals"]
+	return toBoolean(e.callValue(&Method{Function: equals, This: instance}, []Value{b}))
+}
+
+// sets pair of table, throws on unhashable key
+func (e *Evaluator) tableSet(table *Table, key, value Value) {
+	if err := e.SetPair(table, key, value); err != nil {
+		e.ThrowException("%s", err.Error())
+	}
+}
+
+// SetPair sets pair of table hashing key by its hash and equals methods
+// as scripts do, so it may call script, returns error for unhashable key
+func (e *Evaluator) SetPair(table *Table, key, value Value) error {
+	existed, err := table.Pairs.put(e, key, value)
+	if err != nil {
+		return err
+	}
+	if !existed {
+		e.alloc(sizeEntry)
+	}
+	return nil
+}
+
+func (e *Evaluator) tableArg(args []Value, i int) *Table {
+	table, ok := args[i].(*Table)
+	if !ok {
+		e.ThrowException("argument %d: expected table, got %s", i+1, args[i].Type())
+	}
+	return table
+}
+
+func tbl_size(e *Evaluator, this Value, args ...Value) Value {
+	return &Number{Value: float64(this.(*Table).Pairs.Size())}
+}
+
+// deletes key, reports whether it existed
+func tbl_delete(e *Evaluator, this Value, args ...Value) Value {
+	existed, err := this.(*Table).Pairs.remove(e, args[0])
+	if err != nil {
+		e.ThrowException("%s", err.Error())
+	}
+	return &Boolean{Value: existed}
+}
+
+func tbl_keys(e *Evaluator, this Value, args ...Value) Value {
+	entries := this.(*Table).Pairs.Entries()
+	arr := &Array{Elements: make([]Value, len(entries))}
+	for i, entry := range entries {
+		arr.Elements[i] = entry.Key
+	}
+	e.alloc(sizeValue * len(entries))
+	return arr
+}
+
+func tbl_values(e *Evaluator, this Value, args ...Value) Value {
+	entries := this.(*Table).Pairs.Entries()
+	arr := &Array{Elements: make([]Value, len(entries))}
+	for i, entry := range entries {
+		arr.Elements[i] = entry.Value
+	}
+	e.alloc(sizeValue * len(entries))
+	return arr
+}
+
+// arrays of key and value
+func tbl_entries(e *Evaluator, this Value, args ...Value) Value {
+	entries := this.(*Table).Pairs.Entries()
+	arr := &Array{Elements: make([]Value, len(entries))}
+	for i, entry := range entries {
+		arr.Elements[i] = &Array{Elements: []Value{entry.Key, entry.Value}}
+	}
+	e.alloc(3 * sizeValue * len(entries))
+	return arr
+}
+
+func tbl_has(e *Evaluator, this Value, args ...Value) Value {
+	_, ok, err := this.(*Table).Pairs.lookup(e, args[0])
+	if err != nil {
+		e.ThrowException("%s", err.Error())
+	}
+	return &Boolean{Value: ok}
+}
+
+// value of key or default when key is missing
+func tbl_get(e *Evaluator, this Value, args ...Value) Value {
+	value, ok, err := this.(*Table).Pairs.lookup(e, args[0])
+	if err != nil {
+		e.ThrowException("%s", err.Error())
+	}
+	if !ok {
+		return args[1]
+	}
+	return value
+}
+
+// copies pairs of given tables into this one, later ones win
+func tbl_merge(e *Evaluator, this Value, args ...Value) Value {
+	table := this.(*Table)
+	for i := range args {
+		for _, entry := range e.tableArg(args, i).Pairs.Entries() {
+			e.tableSet(table, entry.Key, entry.Value)
+		}
+	}
+	return table
+}
+
+func tbl_clear(e *Evaluator, this Value, args ...Value) Value {
+	this.(*Table).Pairs.Clear()
+	return e.env.globals.Null
+}
+
+// shallow copy keeping order
+func tbl_copy(e *Evaluator, this Value, args ...Value) Value {
+	table := &Table{Pairs: this.(*Table).Pairs.Copy()}
+	e.alloc(sizeEntry * table.Pairs.Size())
+	return table
+}
@@ -1,6 +1,9 @@
 package evaluator
 
-import "strconv"
+import (
+	"slices"
+	"strconv"
+)
 
 const (
 	CLASS_NUMBER    = "Number"
@@ -12,6 +15,14 @@ const (
 
 func newNumberClass() *Class {
 	return &Class{
+		Constructors: map[string]*Function{
+			"new": NewNative(
+				hostConstructor(func(e *Evaluator, args []Value) Value {
+					return &Number{Value: e.numberArg(args, 0)}
+				}),
+				Param{Name: "value", Default: &Number{Value: 0}},
+			),
+		},
 		Public: map[string]*Function{
 			"to_string": {
 				FType: F_NATIVE,
@@ -33,110 +44,51 @@ func newNumberClass() *Class {
 
 func newStringClass() *Class {
 	return &Class{
-		Public: map[string]*Function{
-			"reverse": {
-				FType: F_NATIVE,
-				Native: coverNative(func(e *Evaluator, this Value, args ...Value) Value {
-					str := this.(*String)
-					rev := []rune(str.Value)
-					for i := 0; i < len(rev)/2; i++ {
-						alt := len(rev) - i - 1
-						rev[i], rev[alt] = rev[alt], rev[i]
-					}
-					return &String{Value: string(rev)}
-				}, 0),
-			},
-			"to_upper_case": {
-				FType: F_NATIVE,
-				Native: coverNative(func(e *Evaluator, this Value, args ...Value) Value {
-					str := this.(*String)
-					up := []rune(str.Value)
-					for i := range len(up) {
-						if 'a' <= up[i] && up[i] <= 'z' {
-							up[i] += 'A' - 'a'
-						}
-					}
-					return &String{Value: string(up)}
-				}, 0),
-			},
-			"to_lower_case": {
-				FType: F_NATIVE,
-				Native: coverNative(func(e *Evaluator, this Value, args ...Value) Value {
-					str := this.(*String)
-					low := []rune(str.Value)
-					for i := range len(low) {
-						if 'A' <= low[i] && low[i] <= 'Z' {
-							low[i] -= 'A' - 'a'
-						}
-					}
-					return &String{Value: string(low)}
-				}, 0),
-			},
+		Constructors: map[string]*Function{
+			"new": NewNative(
+				hostConstructor(func(e *Evaluator, args []Value) Value {
+					return e.newString(e.stringArg(args, 0))
+				}),
+				Param{Name: "value", Default: &String{Value: ""}},
+			),
 		},
+		Public: stringMethods(),
 	}
 }
 
 func newArrayClass() *Class {
 	return &Class{
-		Public: map[string]*Function{
-			"push": {
-				FType: F_NATIVE,
-				Native: coverNative(func(e *Evaluator, this Value, args ...Value) Value {
-					arr := this.(*Array)
-					arr.Elements = append(arr.Elements, args...)
-					return e.env.globals.Null
-				}, 1),
-			},
-			"pop": {
-				FType: F_NATIVE,
-				Native: coverNative(func(e *Evaluator, this Value, args ...Value) Value {
-					arr := this.(*Array)
-					if len(arr.Elements) == 0 {
-						e.ThrowException("array is empty")
-					}
-					elem := arr.Elements[len(arr.Elements)-1]
-					arr.Elements = arr.Elements[:len(arr.Elements)-1]
-					return elem
-				}, 0),
-			},
-			"length": {
-				FType: F_NATIVE,
-				Native: coverNative(func(e *Evaluator, this Value, args ...Value) Value {
-					arr := this.(*Array)
-					return &Number{Value: float64(len(arr.Elements))}
-				}, 0),
-			},
+		Constructors: map[string]*Function{
+			"new": native(hostConstructor(func(e *Evaluator, args []Value) Value {
+				e.alloc(sizeValue * len(args))
+				return &Array{Elements: slices.Clone(args)}
+			}), -1),
 		},
+		Public: arrayMethods(),
 	}
 }
 
 func newTableClass() *Class {
 	return &Class{
-		Public: map[string]*Function{
-			"size": {
-				FType: F_NATIVE,
-				Native: coverNative(func(e *Evaluator, this Value, args ...Value) Value {
-					tbl := this.(*Table)
-					return &Number{Value: float64(tbl.Pairs.Size())}
-				}, 0),
-			},
-			"delete": {
-				FType: F_NATIVE,
-				Native: coverNative(func(e *Evaluator, this Value, args ...Value) Value {
-					tbl := this.(*Table)
-					exist, err := tbl.Pairs.Delete(args[0])
-					if err != nil {
-						e.ThrowException("%s", err.Error())
-					}
-					return &Boolean{Value: exist}
-				}, 1),
-			},
+		Constructors: map[string]*Function{
+			"new": native(hostConstructor(func(e *Evaluator, args []Value) Value {
+				return &Table{Pairs: NewHashTable()}
+			}), 0),
 		},
+		Public: tableMethods(),
 	}
 }
 
 func newExceptionClass() *Class {
 	return &Class{
+		Constructors: map[string]*Function{
+			"new": NewNative(
+				hostConstructor(func(e *Evaluator, args []Value) Value {
+					return &Exception{Message: e.stringArg(args, 0)}
+				}),
+				Param{Name: "message", Default: &String{Value: ""}},
+			),
+		},
 		Public: map[string]*Function{
 			"message": {
 				FType: F_NATIVE,
@@ -145,6 +97,20 @@ func newExceptionClass() *Class {
 					return &String{Value: exc.Message}
 				}, 0),
 			},
+			"stack_trace": {
+				FType: F_NATIVE,
+				Native: coverNative(func(e *Evaluator, this Value, args ...Value) Value {
+					exc := this.(*Exception)
+					trace := &Array{Elements: []Value{}}
+					for _, entry := range exc.StackTrace {
+						trace.Elements = append(
+							trace.Elements,
+							&String{Value: entry.String()},
+						)
+					}
+					return trace
+				}, 0),
+			},
 		},
 	}
 }
@@ -156,5 +122,115 @@ func CreateBaseClasses() map[string]*Class {
 	classes[CLASS_ARRAY] = newArrayClass()
 	classes[CLASS_TABLE] = newTableClass()
 	classes[CLASS_EXCEPTION] = newExceptionClass()
+	for name, class := range classes {
+		class.Name = name
+		for method, fun := range class.Constructors {
+			fun.Name = name + "." + method
+		}
+		for method, fun := range class.Public {
+			fun.Name = name + "." + method
+			fun.Native = hosted(fun.Native, fun.Name)
+		}
+	}
 	return classes
 }
+
+// constructor of builtin class keeping value made by f in Host of
+// instance, instances of subclasses get builtin methods this way
+func hostConstructor(f func(e *Evaluator, args []Value) Value) NativeFunction {
+	return func(e *Evaluator, this Value, args ...Value) Value {
+		this.(*Instance).Host = f(e, args)
+		return this
+	}
+}
+
+// method of builtin class run on value held by instance
+func hosted(f NativeFunction, name string) NativeFunction {
+	return func(e *Evaluator, this Value, args ...Value) Value {
+		if instance, ok := this.(*Instance); ok {
+			value, ok := instance.Host.(Value)
+			if !ok {
+				e.ThrowException("%s needs constructed instance", name)
+			}
+			this = value
+		}
+		return f(e, this, args...)
+	}
+}
+
+// sets parent of class, members class does not declare are inherited,
+// own methods remember class so super finds its parent
+func (e *Evaluator) inherit(class *Class, parent Value) {
+	for _, methods := range []map[string]*Function{
+		class.Constructors,
+		class.Public,
+		class.Private,
+		class.Getters,
+		class.Setters,
+	} {
+		for _, fun := range methods {
+			fun.Owner = class
+		}
+	}
+	if parent == nil {
+		return
+	}
+	base, ok := parent.(*Class)
+	if !ok {
+		e.ThrowException("cannot extend %s", parent.Type())
+	}
+	class.Parent = base
+	for name := range base.PublicFields {
+		if _, own := class.Fields[name]; !own {
+			class.PublicFields[name] = true
+		}
+	}
+	inheritMembers(class.Fields, base.Fields)
+	inheritMembers(class.Constructors, base.Constructors)
+	inheritMembers(class.Public, base.Public)
+	inheritMembers(class.Private, base.Private)
+	inheritMembers(class.Getters, base.Getters)
+	inheritMembers(class.Setters, base.Setters)
+}
+
+func inheritMembers[V any](own, parent map[string]V) {
+	for name, member := range parent {
+		if _, ok := own[name]; !ok {
+			own[name] = member
+		}
+	}
+}
+
+// member of parent of class declaring current method, methods and
+// constructors are bound to this, getters are called
+func (e *Evaluator) super(name string) Value {
+	this, owner := e.env.GetThis(), e.env.GetOwner()
+	if owner == nil || owner.Parent == nil {
+		e.ThrowException("'super' outside of subclass method")
+	}
+	parent := owner.Parent
+	for _, methods := range []map[string]*Function{
+		parent.Public,
+		parent.Private,
+		parent.Constructors,
+	} {
+		if fun, ok := methods[name]; ok {
+			return &Method{Function: fun, This: this}
+		}
+	}
+	if get, ok := parent.Getters[name]; ok {
+		return e.callFunction(get, this, []Value{})
+	}
+	e.ThrowException("class %s has no member '%s'", parent.Name, name)
+	return nil
+}
+
+// reports whether class is base or inherits from it
+func (c *Class) extends(base *Class) bool {
+	for ; c != nil; c = c.Parent {
+		if c == base {
+			return true
+		}
+	}
+	return false
+}
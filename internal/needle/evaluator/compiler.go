@@ -0,0 +1,692 @@
+package evaluator
+
+import (
+	"fmt"
+	"needle/internal/needle/parser"
+	"slices"
+)
+
+const maxOperand = 0xFFFF
+
+type compileError struct {
+	Error error
+}
+
+func panicCompileError(message string, a ...any) {
+	panic(&compileError{Error: fmt.Errorf(message, a...)})
+}
+
+// switch statements take breaks only, continues go to enclosing loop
+type loopContext struct {
+	isSwitch   bool
+	breaks     []int
+	continues  []int
+	scopeDepth int
+	tryDepth   int
+}
+
+type compiler struct {
+	code       *Code
+	names      map[string]int
+	inFunction bool
+	scopeDepth int
+	tryDepth   int
+	loops      []*loopContext
+}
+
+func newCompiler(inFunction bool) *compiler {
+	return &compiler{
+		code: &Code{
+			Instructions: []byte{},
+			Constants:    []Value{},
+			Names:        []string{},
+			Functions:    []*Code{},
+			Classes:      []*ClassTemplate{},
+			Imports:      []*parser.ImportStatement{},
+			Parameters:   []string{},
+		},
+		names:      map[string]int{},
+		inFunction: inFunction,
+		loops:      []*loopContext{},
+	}
+}
+
+// Compile translates script to bytecode executed by the vm backend
+func Compile(script *parser.Script) (code *Code, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if cErr, ok := r.(*compileError); ok {
+				code, err = nil, cErr.Error
+				return
+			}
+			panic(r)
+		}
+	}()
+	c := newCompiler(false)
+	c.statements(script.Statements)
+	c.emit(OP_NULL)
+	c.emit(OP_RETURN)
+	return c.code, nil
+}
+
+func (c *compiler) statements(stmts []parser.Statement) {
+	for _, stmt := range stmts {
+		c.statement(stmt)
+	}
+}
+
+func (c *compiler) statement(node parser.Statement) {
+	switch node := node.(type) {
+	case *parser.Block:
+		c.emit(OP_ENTER_SCOPE, node.Slots)
+		c.scopeDepth++
+		c.statements(node.Statements)
+		c.scopeDepth--
+		c.emit(OP_EXIT_SCOPE)
+	case *parser.Declaration:
+		c.expression(node.Right)
+		c.declare(node.Identifier)
+	case *parser.SayStatement:
+		c.expression(node.Expression)
+		c.emit(OP_SAY)
+	case *parser.IfStatement:
+		c.expression(node.Condition)
+		elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+		c.statement(node.Then)
+		endJump := c.emitJump(OP_JUMP)
+		c.patchJump(elseJump)
+		c.statement(node.Else)
+		c.patchJump(endJump)
+	case *parser.WhileStatement:
+		start := len(c.code.Instructions)
+		c.expression(node.Condition)
+		exitJump := c.emitJump(OP_JUMP_IF_FALSE)
+		loop := c.enterLoop()
+		c.statement(node.Do)
+		c.emit(OP_JUMP, start)
+		c.patchJump(exitJump)
+		c.exitLoop(loop, start)
+	case *parser.ForStatement:
+		c.emit(OP_ENTER_SCOPE, node.Slots)
+		c.scopeDepth++
+		c.statement(node.Init)
+		start := len(c.code.Instructions)
+		c.expression(node.Condition)
+		exitJump := c.emitJump(OP_JUMP_IF_FALSE)
+		loop := c.enterLoop()
+		c.statement(node.Do)
+		update := len(c.code.Instructions)
+		c.statement(node.Update)
+		c.emit(OP_JUMP, start)
+		c.patchJump(exitJump)
+		c.exitLoop(loop, update)
+		c.scopeDepth--
+		c.emit(OP_EXIT_SCOPE)
+	case *parser.ForInStatement:
+		c.forIn(node)
+	case *parser.SwitchStatement:
+		c.switch_(node)
+	case *parser.DoStatement:
+		start := len(c.code.Instructions)
+		loop := c.enterLoop()
+		c.statement(node.Do)
+		condition := len(c.code.Instructions)
+		c.expression(node.While)
+		c.emit(OP_JUMP_IF_TRUE, start)
+		c.exitLoop(loop, condition)
+	case *parser.ExpressionStatement:
+		c.expression(node.Expression)
+		c.emit(OP_POP)
+	case *parser.AssignmentStatement:
+		c.assignment(node)
+	case *parser.ReturnStatement:
+		c.expression(node.Value)
+		if !c.inFunction {
+			c.emit(OP_POP)
+			c.emitError("'return' outside function")
+			return
+		}
+		c.emit(OP_RETURN)
+	case *parser.BreakStatement:
+		if len(c.loops) == 0 {
+			c.emitError("'break' outside loop or switch")
+			return
+		}
+		loop := c.loops[len(c.loops)-1]
+		c.leaveTo(loop)
+		loop.breaks = append(loop.breaks, c.emitJump(OP_JUMP))
+	case *parser.ContinueStatement:
+		i := len(c.loops) - 1
+		for i >= 0 && c.loops[i].isSwitch {
+			i--
+		}
+		if i < 0 {
+			c.emitError("'continue' outside loop")
+			return
+		}
+		loop := c.loops[i]
+		c.leaveTo(loop)
+		loop.continues = append(loop.continues, c.emitJump(OP_JUMP))
+	case *parser.TryStatement:
+		c.try(node)
+	case *parser.ThrowStatement:
+		c.expression(node.Error)
+		c.at(node)
+		c.emit(OP_THROW)
+	case *parser.ImportStatement:
+		c.code.Imports = append(c.code.Imports, node)
+		c.emit(OP_IMPORT, c.index(len(c.code.Imports)-1))
+	case *parser.ExportStatement:
+		if node.Declaration != nil {
+			c.statement(node.Declaration)
+			c.emit(OP_EXPORT, c.name(node.Declaration.Identifier.Value))
+			return
+		}
+		for _, name := range node.Names {
+			c.emit(OP_EXPORT, c.name(name.Value))
+		}
+	default:
+		panicCompileError("can't compile %s", node)
+	}
+}
+
+func (c *compiler) assignment(node *parser.AssignmentStatement) {
+	c.expression(node.Right)
+	switch left := node.Left.(type) {
+	case *parser.IdentifierLiteral:
+		if left.Local {
+			c.emit(OP_SET_LOCAL, left.Depth, left.Index)
+		} else {
+			c.at(node)
+			c.emit(OP_SET_NAME, c.name(left.Value))
+		}
+	case *parser.PropertyExpression:
+		name := c.name(left.Property.Value)
+		if _, isThis := left.Left.(*parser.ThisLiteral); isThis {
+			c.at(node)
+			c.emit(OP_SET_THIS_PROP, name)
+			return
+		}
+		c.expression(left.Left)
+		c.at(node)
+		c.emit(OP_SET_PROP, name)
+	case *parser.IndexExpression:
+		c.expression(left.Index)
+		c.expression(left.Left)
+		c.at(node)
+		c.emit(OP_SET_INDEX)
+	default:
+		c.emit(OP_POP)
+		c.emitError("can't assign to ???")
+	}
+}
+
+// try body, then catch clauses tested in order with exception on
+// stack, finally runs after all and rethrows unhandled exception
+func (c *compiler) try(node *parser.TryStatement) {
+	handler := c.emitJump(OP_SETUP_TRY)
+	c.tryDepth++
+	c.statement(node.Try)
+	c.tryDepth--
+	c.emit(OP_POP_TRY)
+	tryEnd := c.emitJump(OP_JUMP)
+
+	c.patchJump(handler)
+	catchEnds := []int{}
+	rethrows := []int{}
+	pending := []int{}
+	if len(node.Catches) > 0 {
+		filterFail := c.emitJump(OP_SETUP_TRY)
+		for _, clause := range node.Catches {
+			next := -1
+			if clause.Type != nil {
+				c.expression(clause.Type)
+				c.emit(OP_MATCH_EXC)
+				next = c.emitJump(OP_JUMP_IF_FALSE)
+			}
+			c.emit(OP_POP_TRY)
+			c.emit(OP_CAUGHT)
+			c.emit(OP_ENTER_SCOPE, 1)
+			c.scopeDepth++
+			c.declare(clause.As)
+			rethrows = append(rethrows, c.emitJump(OP_SETUP_TRY))
+			c.tryDepth++
+			c.statement(clause.Body)
+			c.tryDepth--
+			c.emit(OP_POP_TRY)
+			c.scopeDepth--
+			c.emit(OP_EXIT_SCOPE)
+			catchEnds = append(catchEnds, c.emitJump(OP_JUMP))
+			if next >= 0 {
+				c.patchJump(next)
+			}
+		}
+		c.emit(OP_POP_TRY)
+		pending = append(pending, c.emitJump(OP_JUMP))
+
+		// exception thrown by catch type replaces caught one
+		c.patchJump(filterFail)
+		c.emit(OP_SWAP)
+		c.emit(OP_POP)
+		pending = append(pending, c.emitJump(OP_JUMP))
+
+		for _, rethrow := range rethrows {
+			c.patchJump(rethrow)
+		}
+		c.emit(OP_EXIT_SCOPE)
+	}
+	for _, jump := range pending {
+		c.patchJump(jump)
+	}
+	c.statement(node.Finally)
+	c.emit(OP_RETHROW)
+
+	c.patchJump(tryEnd)
+	for _, jump := range catchEnds {
+		c.patchJump(jump)
+	}
+	c.statement(node.Finally)
+}
+
+func (c *compiler) expression(node parser.Expression) {
+	switch node := node.(type) {
+	case *parser.InfixExpression:
+		c.expression(node.Left)
+		c.expression(node.Right)
+		c.at(node)
+		c.emit(OP_BINARY, c.operator(node.Operator))
+	case *parser.PrefixExpression:
+		c.expression(node.Right)
+		c.at(node)
+		c.emit(OP_UNARY, c.operator(node.Operator))
+	case *parser.CallExpression:
+		c.expression(node.Left)
+		if hasSpecialArguments(node.Arguments) {
+			names := c.arguments(node.Arguments)
+			c.at(node)
+			c.emit(OP_CALL_ARGS, names)
+			return
+		}
+		for _, arg := range node.Arguments {
+			c.expression(arg)
+		}
+		c.at(node)
+		c.emit(OP_CALL, c.index(len(node.Arguments)))
+	case *parser.PropertyExpression:
+		c.expression(node.Left)
+		c.at(node)
+		if _, isThis := node.Left.(*parser.ThisLiteral); isThis {
+			c.emit(OP_GET_THIS_PROP, c.name(node.Property.Value))
+		} else {
+			c.emit(OP_GET_PROP, c.name(node.Property.Value))
+		}
+	case *parser.IndexExpression:
+		c.expression(node.Left)
+		c.expression(node.Index)
+		c.at(node)
+		c.emit(OP_GET_INDEX)
+	case *parser.SliceExpression:
+		c.expression(node.Left)
+		c.expression(node.Start)
+		c.expression(node.End)
+		c.at(node)
+		c.emit(OP_SLICE)
+
+	case *parser.IdentifierLiteral:
+		c.at(node)
+		if node.Local {
+			c.emit(OP_GET_LOCAL, node.Depth, node.Index)
+		} else {
+			c.emit(OP_GET_NAME, c.name(node.Value))
+		}
+	case *parser.ThisLiteral:
+		c.emit(OP_THIS)
+	case *parser.SuperExpression:
+		c.at(node)
+		c.emit(OP_SUPER, c.name(node.Property.Value))
+	case *parser.NullLiteral:
+		c.emit(OP_NULL)
+	case *parser.BooleanLiteral:
+		if node.Value {
+			c.emit(OP_TRUE)
+		} else {
+			c.emit(OP_FALSE)
+		}
+	case *parser.NumberLiteral:
+		c.emit(OP_CONSTANT, c.constant(&Number{Value: node.Value}))
+	case *parser.StringLiteral:
+		c.emit(OP_CONSTANT, c.constant(&String{Value: node.Value}))
+	case *parser.TemplateLiteral:
+		c.emit(OP_CONSTANT, c.constant(&String{Value: node.Strings[0]}))
+		for i, value := range node.Values {
+			c.expression(value)
+			c.emit(OP_CONSTANT, c.constant(&String{Value: node.Strings[i+1]}))
+		}
+		c.at(node)
+		c.emit(OP_CONCAT, c.index(2*len(node.Values)+1))
+	case *parser.FunctionLiteral:
+		c.emit(OP_CLOSURE, c.function(node))
+	case *parser.ClassLiteral:
+		c.class(node)
+	case *parser.ArrayLiteral:
+		for _, elem := range node.Elements {
+			c.expression(elem)
+		}
+		c.emit(OP_ARRAY, c.index(len(node.Elements)))
+	case *parser.ConditionalExpression:
+		c.expression(node.Condition)
+		elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+		c.expression(node.Then)
+		endJump := c.emitJump(OP_JUMP)
+		c.patchJump(elseJump)
+		c.expression(node.Else)
+		c.patchJump(endJump)
+	case *parser.WhenExpression:
+		c.when(node)
+	case *parser.TableLiteral:
+		for _, pair := range node.Pairs {
+			c.expression(pair.Key)
+			c.expression(pair.Value)
+		}
+		c.emit(OP_TABLE, c.index(len(node.Pairs)))
+	default:
+		panicCompileError("can't compile %s", node)
+	}
+}
+
+func (c *compiler) declare(ident *parser.IdentifierLiteral) {
+	if ident.Local {
+		c.emit(OP_SET_LOCAL, ident.Depth, ident.Index)
+		return
+	}
+	c.at(ident)
+	c.emit(OP_DECLARE, c.name(ident.Value))
+}
+
+func (c *compiler) function(node *parser.FunctionLiteral) int {
+	fc := newCompiler(true)
+	fc.code.Name = node.Name
+	fc.at(node)
+	for _, param := range node.Parameters {
+		fc.code.Parameters = append(fc.code.Parameters, param.Value)
+	}
+	fc.code.Slots = node.Slots
+	fc.code.Required = required(node)
+	fc.code.Rest = node.Rest != nil
+	for i := fc.code.Required; i < len(node.Parameters); i++ {
+		fc.emit(OP_DEFAULT, i, 0)
+		skip := len(fc.code.Instructions) - 2
+		fc.expression(node.Defaults[i])
+		fc.emit(OP_SET_LOCAL, 0, i)
+		fc.patchJump(skip)
+	}
+	fc.statements(node.Body.Statements)
+	fc.emit(OP_NULL)
+	fc.emit(OP_RETURN)
+	c.code.Functions = append(c.code.Functions, fc.code)
+	return c.index(len(c.code.Functions) - 1)
+}
+
+func hasSpecialArguments(args []parser.Expression) bool {
+	for _, arg := range args {
+		switch arg.(type) {
+		case *parser.SpreadExpression, *parser.NamedArgument:
+			return true
+		}
+	}
+	return false
+}
+
+// positional arguments are collected into array, named ones
+// follow it on stack, returns const index of names
+func (c *compiler) arguments(args []parser.Expression) int {
+	c.emit(OP_ARRAY, 0)
+	names := &Array{Elements: []Value{}}
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case *parser.SpreadExpression:
+			c.expression(arg.Value)
+			c.at(arg)
+			c.emit(OP_SPREAD)
+		case *parser.NamedArgument:
+			c.expression(arg.Value)
+			names.Elements = append(names.Elements, &String{Value: arg.Name.Value})
+		default:
+			c.expression(arg)
+			c.emit(OP_APPEND)
+		}
+	}
+	return c.constant(names)
+}
+
+func (c *compiler) class(node *parser.ClassLiteral) {
+	template := &ClassTemplate{Name: node.Name, Parent: node.Parent != nil}
+	if node.Parent != nil {
+		c.expression(node.Parent)
+	}
+	for _, decl := range node.Fields {
+		c.expression(decl.Right)
+		template.Fields = append(template.Fields, decl.Identifier.Value)
+		if node.PublicFields[decl.Identifier.Value] {
+			template.PublicFields = append(template.PublicFields, decl.Identifier.Value)
+		}
+	}
+	methods := func(m map[*parser.IdentifierLiteral]*parser.FunctionLiteral) []string {
+		names := []string{}
+		for ident, lit := range m {
+			c.emit(OP_CLOSURE, c.function(lit))
+			names = append(names, ident.Value)
+		}
+		return names
+	}
+	template.Constructors = methods(node.Constructors)
+	template.Public = methods(node.Public)
+	template.Private = methods(node.Private)
+	template.Getters = methods(node.Getters)
+	template.Setters = methods(node.Setters)
+	c.code.Classes = append(c.code.Classes, template)
+	if node.Parent != nil {
+		c.at(node.Parent)
+	}
+	c.emit(OP_CLASS, c.index(len(c.code.Classes)-1))
+}
+
+/* == loops ==================================================================*/
+
+// iterator stays on stack for whole loop, breaks land on its pop
+func (c *compiler) forIn(node *parser.ForInStatement) {
+	count := 1
+	if node.Key != nil {
+		count = 2
+	}
+	c.expression(node.Iterable)
+	c.at(node.Iterable)
+	c.emit(OP_ITER)
+	start := len(c.code.Instructions)
+	c.emit(OP_ITER_NEXT, 0, count)
+	exitJump := len(c.code.Instructions) - 4
+	loop := c.enterLoop()
+	c.emit(OP_ENTER_SCOPE, node.Slots)
+	c.scopeDepth++
+	c.declare(node.Value)
+	if node.Key != nil {
+		c.declare(node.Key)
+	}
+	c.statement(node.Do)
+	c.scopeDepth--
+	c.emit(OP_EXIT_SCOPE)
+	c.emit(OP_JUMP, start)
+	c.patchJump(exitJump)
+	c.exitLoop(loop, start)
+	c.emit(OP_POP)
+}
+
+// subject stays on stack while cases are tested, matched
+// case pops it before running body
+func (c *compiler) switch_(node *parser.SwitchStatement) {
+	c.expression(node.Subject)
+	matches := make([][]int, len(node.Cases))
+	for i, cs := range node.Cases {
+		matches[i] = c.matches(cs.Values)
+	}
+	c.emit(OP_POP)
+	loop := c.enterLoop()
+	loop.isSwitch = true
+	if node.Default != nil {
+		c.statement(node.Default)
+	}
+	ends := []int{c.emitJump(OP_JUMP)}
+	for i, cs := range node.Cases {
+		for _, jump := range matches[i] {
+			c.patchJump(jump)
+		}
+		c.emit(OP_POP)
+		c.statement(cs.Body)
+		ends = append(ends, c.emitJump(OP_JUMP))
+	}
+	for _, jump := range ends {
+		c.patchJump(jump)
+	}
+	c.exitLoop(loop, 0)
+}
+
+func (c *compiler) when(node *parser.WhenExpression) {
+	c.expression(node.Subject)
+	matches := make([][]int, len(node.Branches))
+	for i, b := range node.Branches {
+		matches[i] = c.matches(b.Values)
+	}
+	c.emit(OP_POP)
+	if node.Default != nil {
+		c.expression(node.Default)
+	} else {
+		c.at(node)
+		c.emit(OP_ERROR, c.constant(&String{Value: "no matching 'when' branch"}))
+	}
+	ends := []int{c.emitJump(OP_JUMP)}
+	for i, b := range node.Branches {
+		for _, jump := range matches[i] {
+			c.patchJump(jump)
+		}
+		c.emit(OP_POP)
+		c.expression(b.Result)
+		ends = append(ends, c.emitJump(OP_JUMP))
+	}
+	for _, jump := range ends {
+		c.patchJump(jump)
+	}
+}
+
+// tests subject on stack top against values, returns jumps taken on match
+func (c *compiler) matches(values []parser.Expression) []int {
+	jumps := []int{}
+	for _, value := range values {
+		c.emit(OP_DUP)
+		c.expression(value)
+		c.at(value)
+		c.emit(OP_BINARY, c.operator(parser.OP_EQ))
+		jumps = append(jumps, c.emitJump(OP_JUMP_IF_TRUE))
+	}
+	return jumps
+}
+
+func (c *compiler) enterLoop() *loopContext {
+	loop := &loopContext{
+		breaks:     []int{},
+		continues:  []int{},
+		scopeDepth: c.scopeDepth,
+		tryDepth:   c.tryDepth,
+	}
+	c.loops = append(c.loops, loop)
+	return loop
+}
+
+func (c *compiler) exitLoop(loop *loopContext, continueTo int) {
+	for _, jump := range loop.breaks {
+		c.patchJump(jump)
+	}
+	for _, jump := range loop.continues {
+		c.patchJumpTo(jump, continueTo)
+	}
+	c.loops = c.loops[:len(c.loops)-1]
+}
+
+// unwinds scopes and try handlers opened inside loop
+func (c *compiler) leaveTo(loop *loopContext) {
+	for range c.scopeDepth - loop.scopeDepth {
+		c.emit(OP_EXIT_SCOPE)
+	}
+	for range c.tryDepth - loop.tryDepth {
+		c.emit(OP_POP_TRY)
+	}
+}
+
+/* == emit ===================================================================*/
+
+func (c *compiler) emit(op Opcode, operands ...int) {
+	c.code.Instructions = append(c.code.Instructions, byte(op))
+	for _, operand := range operands {
+		c.code.Instructions = append(
+			c.code.Instructions,
+			byte(operand>>8),
+			byte(operand),
+		)
+	}
+}
+
+// records node executed by next instruction for stack traces
+func (c *compiler) at(node parser.Node) {
+	c.code.Spans = append(c.code.Spans, CodeSpan{
+		Offset: len(c.code.Instructions),
+		Span:   node.Span(),
+	})
+}
+
+func (c *compiler) emitError(message string) {
+	c.emit(OP_ERROR, c.constant(&String{Value: message}))
+}
+
+// returns position of jump operand to patch later
+func (c *compiler) emitJump(op Opcode) int {
+	c.emit(op, 0)
+	return len(c.code.Instructions) - 2
+}
+
+func (c *compiler) patchJump(pos int) {
+	c.patchJumpTo(pos, len(c.code.Instructions))
+}
+
+func (c *compiler) patchJumpTo(pos int, address int) {
+	address = c.index(address)
+	c.code.Instructions[pos] = byte(address >> 8)
+	c.code.Instructions[pos+1] = byte(address)
+}
+
+func (c *compiler) constant(value Value) int {
+	c.code.Constants = append(c.code.Constants, value)
+	return c.index(len(c.code.Constants) - 1)
+}
+
+func (c *compiler) name(name string) int {
+	if i, ok := c.names[name]; ok {
+		return i
+	}
+	c.code.Names = append(c.code.Names, name)
+	c.names[name] = c.index(len(c.code.Names) - 1)
+	return c.names[name]
+}
+
+func (c *compiler) operator(op parser.Operator) int {
+	i := slices.Index(codeOperators, op)
+	if i < 0 {
+		panicCompileError("unknown operator '%s'", op)
+	}
+	return i
+}
+
+func (c *compiler) index(i int) int {
+	if i > maxOperand {
+		panicCompileError("code too large")
+	}
+	return i
+}
@@ -2,12 +2,12 @@ package evaluator
 
 import (
 	"errors"
-	"maps"
 )
 
 var (
-	errVarAlreadyExists = errors.New("variable already exists")
-	errVarNotExists     = errors.New("variable not exists")
+	errVarAlreadyExists  = errors.New("variable already exists")
+	errVarNotExists      = errors.New("variable not exists")
+	errVarNotInitialized = errors.New("variable not initialized")
 )
 
 type Globals struct {
@@ -24,11 +24,18 @@ func newGlobals() *Globals {
 	}
 }
 
+// Env is either named scope (builtins, module top level) backed by map
+// or local frame backed by slots resolved at compile time
 type Env struct {
 	store   map[string]Value
+	slots   []Value
 	outer   *Env
+	named   *Env
 	this    Value
+	owner   *Class
 	globals *Globals
+	// referenced by closure, so vm never reuses it
+	captured bool
 }
 
 // outer can be nil, but root env must have global outer
@@ -39,53 +46,78 @@ func NewEnv(outer *Env) *Env {
 	} else {
 		g = newGlobals()
 	}
-	return &Env{
+	env := &Env{
 		store:   make(map[string]Value),
 		outer:   outer,
 		globals: g,
 	}
+	env.named = env
+	return env
+}
+
+// NewFrame creates local env with size slots
+func NewFrame(outer *Env, size int) *Env {
+	return &Env{
+		slots:   make([]Value, size),
+		outer:   outer,
+		named:   outer.named,
+		globals: outer.globals,
+	}
+}
+
+// marks env and its outer envs as referenced by closure
+func (e *Env) capture() {
+	for env := e; env != nil && !env.captured; env = env.outer {
+		env.captured = true
+	}
 }
 
+// Declare declares name in nearest named scope
 func (e *Env) Declare(name string, value Value) error {
-	if _, exists := e.store[name]; exists {
+	store := e.named.store
+	if _, exists := store[name]; exists {
 		return errVarAlreadyExists
 	}
-	e.store[name] = value
+	store[name] = value
 	return nil
 }
 
 func (e *Env) Get(name string) (Value, error) {
-	v, exists := e.store[name]
-	if exists {
-		return v, nil
-	}
-	if e.outer != nil {
-		return e.outer.Get(name)
+	for env := e.named; env != nil; env = env.outer {
+		if v, exists := env.store[name]; exists {
+			return v, nil
+		}
 	}
 	return nil, errVarNotExists
 }
 
 func (e *Env) Set(name string, value Value) error {
-	if _, exists := e.store[name]; exists {
-		e.store[name] = value
-		return nil
-	}
-	if e.outer != nil {
-		return e.outer.Set(name, value)
+	for env := e.named; env != nil; env = env.outer {
+		if _, exists := env.store[name]; exists {
+			env.store[name] = value
+			return nil
+		}
 	}
 	return errVarNotExists
 }
 
-func (e *Env) Clone() *Env {
-	var outer *Env
-	if e.outer != nil {
-		outer = e.outer.Clone()
+func (e *Env) GetLocal(depth, index int) (Value, error) {
+	env := e
+	for range depth {
+		env = env.outer
 	}
-	return &Env{
-		store:   maps.Clone(e.store),
-		outer:   outer,
-		globals: e.globals,
+	if v := env.slots[index]; v != nil {
+		return v, nil
+	}
+	return nil, errVarNotInitialized
+}
+
+func (e *Env) SetLocal(depth, index int, value Value) {
+	env := e
+	for range depth {
+		env = env.outer
 	}
+	env.slots[index] = value
 }
 
 func (e *Env) GetThis() Value {
@@ -98,6 +130,18 @@ func (e *Env) GetThis() Value {
 	return nil
 }
 
-func (e *Env) SetThis(this Value) {
+// class declaring method whose frame binds this
+func (e *Env) GetOwner() *Class {
+	if e.this != nil {
+		return e.owner
+	}
+	if e.outer != nil {
+		return e.outer.GetOwner()
+	}
+	return nil
+}
+
+func (e *Env) SetThis(this Value, owner *Class) {
 	e.this = this
+	e.owner = owner
 }
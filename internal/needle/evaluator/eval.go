@@ -1,33 +1,93 @@
 package evaluator
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"maps"
+	"math"
+	"math/rand/v2"
 	"needle/internal/needle/parser"
 	"needle/internal/pkg"
+	"os"
+	"slices"
+	"strings"
+)
+
+type Backend string
+
+const (
+	BACKEND_TREE Backend = "tree"
+	BACKEND_VM   Backend = "vm"
 )
 
 type Evaluator struct {
+	backend        Backend
 	env            *Env
-	callStack      *pkg.Stack[*Function]
+	main           *Env
+	builtins       *Env
+	out            io.Writer
+	in             *bufio.Reader
+	fsRoot         *os.Root
+	fsDir          string
+	rand           *rand.Rand
+	callStack      *pkg.Stack[*traceFrame]
+	file           string
+	sources        map[string]string
 	defaultClasses map[string]*Class
+	modules        *moduleLoader
+	module         *Module
+	limits         Limits
+	ctx            context.Context
+	steps          int
+	allocated      int
 }
 
 func New() *Evaluator {
-	env := NewEnv(nil)
+	builtins := NewEnv(nil)
 	classes := CreateBaseClasses()
 	for name, class := range classes {
-		env.Declare(name, class)
+		builtins.Declare(name, class)
 	}
-	return &Evaluator{
-		env:            env,
-		callStack:      pkg.NewStack[*Function](),
+	main := NewEnv(builtins)
+	e := &Evaluator{
+		backend:        BACKEND_TREE,
+		env:            main,
+		main:           main,
+		builtins:       builtins,
+		out:            os.Stdout,
+		in:             bufio.NewReader(os.Stdin),
+		callStack:      pkg.NewStack[*traceFrame](),
+		sources:        map[string]string{},
 		defaultClasses: classes,
+		modules:        newModuleLoader(),
+		limits:         DefaultLimits,
 	}
+	e.SetArgs(nil)
+	return e
+}
+
+func (e *Evaluator) Run(script *parser.Script) error {
+	return e.protect(func() {
+		if e.module == nil {
+			defer e.enterMain(script.File)()
+		}
+		e.exec(script)
+	})
+}
+
+// Call calls script function or method from host
+func (e *Evaluator) Call(callee Value, args ...Value) (result Value, err error) {
+	err = e.protect(func() {
+		result = e.callValue(callee, args)
+	})
+	return result, err
 }
 
-func (e *Evaluator) Run(script *parser.Script) (err error) {
+// runs f turning exceptions and stray control signals into errors
+func (e *Evaluator) protect(f func()) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			if exc, ok := r.(*Exception); ok {
@@ -51,11 +111,89 @@ func (e *Evaluator) Run(script *parser.Script) (err error) {
 			}
 		}
 	}()
-	e.Eval(script)
+	e.startBudget()
+	f()
 	return nil
 }
 
+// Defined reports whether name is visible in global scope
+func (e *Evaluator) Defined(name string) bool {
+	_, err := e.env.Get(name)
+	return err == nil
+}
+
+func (e *Evaluator) builtinDefined(name string) bool {
+	_, err := e.builtins.Get(name)
+	return err == nil
+}
+
+// SetArgs exposes script arguments as global args array of strings
+func (e *Evaluator) SetArgs(args []string) {
+	arr := &Array{Elements: make([]Value, len(args))}
+	for i, arg := range args {
+		arr.Elements[i] = &String{Value: arg}
+	}
+	e.SetBuiltin("args", arr)
+}
+
+// SetBuiltin declares or replaces name visible to every module
+func (e *Evaluator) SetBuiltin(name string, value Value) {
+	e.builtins.store[name] = value
+}
+
+// Global returns value of global or builtin name
+func (e *Evaluator) Global(name string) (Value, bool) {
+	v, err := e.main.Get(name)
+	return v, err == nil
+}
+
+// SetGlobal declares or replaces name at top level of main script
+func (e *Evaluator) SetGlobal(name string, value Value) {
+	e.main.store[name] = value
+}
+
+// Globals returns sorted names declared at top level of main script
+func (e *Evaluator) Globals() []string {
+	return slices.Sorted(maps.Keys(e.main.store))
+}
+
+// SetOutput redirects say and io output, os.Stdout by default
+func (e *Evaluator) SetOutput(w io.Writer) {
+	e.out = w
+}
+
+// SetInput redirects io.read_line, os.Stdin by default
+func (e *Evaluator) SetInput(r io.Reader) {
+	e.in = bufio.NewReader(r)
+}
+
+// SetBackend selects tree-walking or bytecode execution
+func (e *Evaluator) SetBackend(backend Backend) {
+	e.backend = backend
+}
+
+func (e *Evaluator) exec(script *parser.Script) {
+	oldFile := e.file
+	e.file = script.File
+	e.sources[script.File] = script.Source
+	e.callStack.Push(&traceFrame{name: "<script>", file: script.File})
+	defer func() {
+		e.file = oldFile
+		e.callStack.Pop()
+	}()
+	if e.backend == BACKEND_VM {
+		code, err := Compile(script)
+		if err != nil {
+			e.ThrowException("%s", err.Error())
+		}
+		e.runCode(code)
+		return
+	}
+	e.Eval(script)
+}
+
 func (e *Evaluator) Eval(node parser.Node) Value {
+	e.step()
 	switch node := node.(type) {
 	case *parser.Script:
 		return e.script(node)
@@ -69,6 +207,12 @@ func (e *Evaluator) Eval(node parser.Node) Value {
 		return e.if_(node)
 	case *parser.WhileStatement:
 		return e.while(node)
+	case *parser.ForStatement:
+		return e.for_(node)
+	case *parser.ForInStatement:
+		return e.forIn(node)
+	case *parser.SwitchStatement:
+		return e.switch_(node)
 	case *parser.DoStatement:
 		return e.do(node)
 	case *parser.ExpressionStatement:
@@ -85,6 +229,10 @@ func (e *Evaluator) Eval(node parser.Node) Value {
 		return e.try(node)
 	case *parser.ThrowStatement:
 		return e.throw(node)
+	case *parser.ImportStatement:
+		return e.import_(node)
+	case *parser.ExportStatement:
+		return e.export(node)
 
 	case *parser.InfixExpression:
 		return e.infix(node)
@@ -100,11 +248,10 @@ func (e *Evaluator) Eval(node parser.Node) Value {
 		return e.slice(node)
 
 	case *parser.IdentifierLiteral:
-		val, err := e.env.Get(node.Value)
-		if err != nil {
-			e.ThrowException("%s", err.Error())
-		}
-		return val
+		return e.identifier(node)
+	case *parser.SuperExpression:
+		e.at(node.Span())
+		return e.super(node.Property.Value)
 	case *parser.ThisLiteral:
 		if this := e.env.GetThis(); this == nil {
 			e.ThrowException("'this' is undefined")
@@ -122,12 +269,21 @@ func (e *Evaluator) Eval(node parser.Node) Value {
 		return &Number{Value: node.Value}
 	case *parser.StringLiteral:
 		return &String{Value: node.Value}
+	case *parser.TemplateLiteral:
+		return e.template(node)
 	case *parser.FunctionLiteral:
 		return e.function(node)
 	case *parser.ClassLiteral:
 		return e.class(node)
 	case *parser.ArrayLiteral:
 		return e.array(node)
+	case *parser.ConditionalExpression:
+		if toBoolean(e.Eval(node.Condition)) {
+			return e.Eval(node.Then)
+		}
+		return e.Eval(node.Else)
+	case *parser.WhenExpression:
+		return e.when(node)
 	case *parser.TableLiteral:
 		return e.table(node)
 	default:
@@ -139,7 +295,7 @@ func (e *Evaluator) Eval(node parser.Node) Value {
 func (e *Evaluator) block(node *parser.Block) Value {
 	oldEnv := e.env
 	defer func() { e.env = oldEnv }()
-	e.env = NewEnv(oldEnv)
+	e.env = NewFrame(oldEnv, node.Slots)
 	for _, stmt := range node.Statements {
 		e.Eval(stmt)
 	}
@@ -147,11 +303,34 @@ func (e *Evaluator) block(node *parser.Block) Value {
 }
 
 func (e *Evaluator) declaration(node *parser.Declaration) Value {
-	name := node.Identifier.Value
-	if err := e.env.Declare(name, e.Eval(node.Right)); err != nil {
+	e.declare(node.Identifier, e.Eval(node.Right))
+	return nil
+}
+
+func (e *Evaluator) declare(ident *parser.IdentifierLiteral, value Value) {
+	if ident.Local {
+		e.env.SetLocal(ident.Depth, ident.Index, value)
+		return
+	}
+	if err := e.env.Declare(ident.Value, value); err != nil {
+		e.at(ident.Span())
 		e.ThrowException("%s", err.Error())
 	}
-	return nil
+}
+
+func (e *Evaluator) identifier(node *parser.IdentifierLiteral) Value {
+	var val Value
+	var err error
+	if node.Local {
+		val, err = e.env.GetLocal(node.Depth, node.Index)
+	} else {
+		val, err = e.env.Get(node.Value)
+	}
+	if err != nil {
+		e.at(node.Span())
+		e.ThrowException("%s", err.Error())
+	}
+	return val
 }
 
 func (e *Evaluator) function(node *parser.FunctionLiteral) Value {
@@ -163,14 +342,34 @@ func (e *Evaluator) function(node *parser.FunctionLiteral) Value {
 	)
 	return &Function{
 		FType:      F_FUNCTION,
-		Closure:    e.env.Clone(),
+		Name:       node.Name,
+		File:       e.file,
+		Span:       node.Span(),
+		Closure:    e.env,
 		Body:       node.Body.Statements,
 		Parameters: params,
+		Required:   required(node),
+		Rest:       node.Rest != nil,
+		Defaults:   node.Defaults,
+		Slots:      node.Slots,
+	}
+}
+
+// count of leading parameters without default
+func required(node *parser.FunctionLiteral) int {
+	n := 0
+	for n < len(node.Defaults) && node.Defaults[n] == nil {
+		n++
 	}
+	return n
 }
 
 func (e *Evaluator) class(node *parser.ClassLiteral) Value {
-	class := &Class{}
+	var parent Value
+	if node.Parent != nil {
+		parent = e.Eval(node.Parent)
+	}
+	class := &Class{Name: node.Name}
 	fields, _ := pkg.SliceToMapMap(
 		node.Fields,
 		func(decl *parser.Declaration) (string, Value, error) {
@@ -204,11 +403,16 @@ func (e *Evaluator) class(node *parser.ClassLiteral) Value {
 		f_map_map,
 	)
 	class.Fields = fields
+	class.PublicFields = maps.Clone(node.PublicFields)
 	class.Constructors = ctors
 	class.Public = public
 	class.Private = private
 	class.Getters = getters
 	class.Setters = setters
+	if node.Parent != nil {
+		e.at(node.Parent.Span())
+	}
+	e.inherit(class, parent)
 	return class
 }
 
@@ -217,22 +421,27 @@ func (e *Evaluator) array(node *parser.ArrayLiteral) Value {
 	for _, expr := range node.Elements {
 		arr.Elements = append(arr.Elements, e.Eval(expr))
 	}
+	e.alloc(sizeValue * len(arr.Elements))
 	return arr
 }
 
 func (e *Evaluator) table(node *parser.TableLiteral) Value {
 	table := &Table{Pairs: NewHashTable()}
-	for kExpr, vExpr := range node.Pairs {
-		table.Pairs.Set(e.Eval(kExpr), e.Eval(vExpr))
+	for _, pair := range node.Pairs {
+		e.tableSet(table, e.Eval(pair.Key), e.Eval(pair.Value))
 	}
 	return table
 }
 
 func (e *Evaluator) say(node *parser.SayStatement) Value {
-	fmt.Println(e.Eval(node.Expression).Say())
+	e.sayValue(e.Eval(node.Expression))
 	return nil
 }
 
+func (e *Evaluator) sayValue(value Value) {
+	fmt.Fprintln(e.out, e.show(value))
+}
+
 func (e *Evaluator) if_(node *parser.IfStatement) Value {
 	var toDo parser.Node
 	if toBoolean(e.Eval(node.Condition)) {
@@ -282,6 +491,149 @@ func (e *Evaluator) do(node *parser.DoStatement) Value {
 	return nil
 }
 
+func (e *Evaluator) for_(node *parser.ForStatement) Value {
+	oldEnv := e.env
+	defer func() { e.env = oldEnv }()
+	e.env = NewFrame(oldEnv, node.Slots)
+	e.Eval(node.Init)
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(*BreakSignal); ok {
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	for toBoolean(e.Eval(node.Condition)) {
+		e.loop(node.Do)
+		e.Eval(node.Update)
+	}
+	return nil
+}
+
+func (e *Evaluator) forIn(node *parser.ForInStatement) Value {
+	iterable := e.Eval(node.Iterable)
+	e.at(node.Iterable.Span())
+	iter := e.iterator(iterable)
+	count := 1
+	if node.Key != nil {
+		count = 2
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(*BreakSignal); ok {
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	for {
+		vars, ok := iter.Next(count)
+		if !ok {
+			return nil
+		}
+		e.iteration(node, vars)
+	}
+}
+
+// every iteration gets own frame, so closures capture current variables
+func (e *Evaluator) iteration(node *parser.ForInStatement, vars []Value) {
+	oldEnv := e.env
+	defer func() { e.env = oldEnv }()
+	e.env = NewFrame(oldEnv, node.Slots)
+	copy(e.env.slots, vars)
+	e.loop(node.Do)
+}
+
+// arrays are walked live, tables and strings by snapshot
+func (e *Evaluator) iterator(value Value) *Iterator {
+	i := 0
+	switch value := value.(type) {
+	case *Array:
+		return &Iterator{next: func() (Value, Value, bool) {
+			if i >= len(value.Elements) {
+				return nil, nil, false
+			}
+			i++
+			return &Number{Value: float64(i - 1)}, value.Elements[i-1], true
+		}}
+	case *Table:
+		entries := value.Pairs.Entries()
+		return &Iterator{keyed: true, next: func() (Value, Value, bool) {
+			if i >= len(entries) {
+				return nil, nil, false
+			}
+			i++
+			return entries[i-1].Key, entries[i-1].Value, true
+		}}
+	case *String:
+		chars := []rune(value.Value)
+		return &Iterator{next: func() (Value, Value, bool) {
+			if i >= len(chars) {
+				return nil, nil, false
+			}
+			i++
+			return &Number{Value: float64(i - 1)}, &String{Value: string(chars[i-1])}, true
+		}}
+	}
+	e.ThrowException("%s is not iterable", value.Type())
+	return nil
+}
+
+func (e *Evaluator) switch_(node *parser.SwitchStatement) Value {
+	subject := e.Eval(node.Subject)
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(*BreakSignal); ok {
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	for _, c := range node.Cases {
+		if e.matches(subject, c.Values) {
+			e.Eval(c.Body)
+			return nil
+		}
+	}
+	if node.Default != nil {
+		e.Eval(node.Default)
+	}
+	return nil
+}
+
+func (e *Evaluator) when(node *parser.WhenExpression) Value {
+	subject := e.Eval(node.Subject)
+	for _, b := range node.Branches {
+		if e.matches(subject, b.Values) {
+			return e.Eval(b.Result)
+		}
+	}
+	if node.Default == nil {
+		e.at(node.Span())
+		e.ThrowException("no matching 'when' branch")
+	}
+	return e.Eval(node.Default)
+}
+
+// compares subject with case values by == until first match
+func (e *Evaluator) matches(subject Value, values []parser.Expression) bool {
+	for _, value := range values {
+		right := e.Eval(value)
+		e.at(value.Span())
+		if toBoolean(e.binary(parser.OP_EQ, subject, right)) {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *Evaluator) loop(do parser.Statement) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -305,101 +657,242 @@ func (e *Evaluator) assignment(
 	node *parser.AssignmentStatement,
 ) Value {
 	right := e.Eval(node.Right)
+	e.at(node.Span())
 
 	switch left := node.Left.(type) {
 	case *parser.IdentifierLiteral:
-		if err := e.env.Set(left.Value, right); err != nil {
+		if left.Local {
+			e.env.SetLocal(left.Depth, left.Index, right)
+		} else if err := e.env.Set(left.Value, right); err != nil {
 			e.ThrowException("%s", err.Error())
 		}
 	case *parser.PropertyExpression:
 		prop := left.Property.Value
 		if _, isThis := left.Left.(*parser.ThisLiteral); isThis {
-			instance := e.env.GetThis()
-			if instance == nil {
-				e.ThrowException("'this' is undefined")
-			}
-			if _, ok := instance.(*Instance).Fields[prop]; !ok {
-				e.ThrowException("missing field")
-			}
-			instance.(*Instance).Fields[prop] = right
+			e.setThisProperty(prop, right)
 			return nil
 		}
 		obj := e.Eval(left.Left)
-		switch obj := obj.(type) {
-		case *Instance:
-			if setter, ok := obj.Class.Setters[prop]; !ok {
-				e.ThrowException("missing setter")
-			} else {
-				e.callFunction(setter, obj, []parser.Expression{node.Right}) // TODO
-				return nil
-			}
-		}
+		e.at(node.Span())
+		e.setProperty(obj, prop, right)
 	case *parser.IndexExpression:
 		index := e.Eval(left.Index)
 		obj := e.Eval(left.Left)
-		switch obj := obj.(type) {
-		case *Array:
-			index, ok := index.(*Number)
-			if !ok {
-				e.ThrowException("non umber index")
-			}
-			intIndex := int(index.Value)
-			if intIndex < 0 || intIndex >= len(obj.Elements) {
-				e.ThrowException("index out of range")
-			}
-			obj.Elements[intIndex] = right
-			return nil
-		case *Table:
-			_, err := obj.Pairs.Set(index, right)
-			if err != nil {
-				e.ThrowException("%s", err.Error())
-			}
-			return nil
-		}
+		e.at(node.Span())
+		e.setIndex(obj, index, right)
 	default:
 		e.ThrowException("can't assign to ???")
 	}
 	return nil
 }
 
+// sets field of this, setter is called for property without field
+func (e *Evaluator) setThisProperty(prop string, value Value) {
+	this := e.env.GetThis()
+	if this == nil {
+		e.ThrowException("'this' is undefined")
+	}
+	instance, ok := this.(*Instance)
+	if !ok {
+		e.ThrowException("cannot set property '%s' of %s", prop, this.Type())
+	}
+	if _, ok := instance.Fields[prop]; ok {
+		instance.Fields[prop] = value
+		return
+	}
+	e.setProperty(instance, prop, value)
+}
+
+// calls setter or sets public field, other fields are private and
+// properties with getter only are read-only
+func (e *Evaluator) setProperty(obj Value, prop string, value Value) {
+	instance, ok := obj.(*Instance)
+	if !ok {
+		e.ThrowException("cannot set property '%s' of %s", prop, obj.Type())
+	}
+	class := instance.Class
+	if setter, ok := class.Setters[prop]; ok {
+		e.callFunction(setter, instance, []Value{value})
+		return
+	}
+	if _, ok := instance.Fields[prop]; ok && class.PublicFields[prop] {
+		instance.Fields[prop] = value
+		return
+	}
+	e.throwMissing(class, prop, true)
+}
+
+// explains why property of class cannot be read or written from outside
+func (e *Evaluator) throwMissing(class *Class, prop string, write bool) {
+	_, getter := class.Getters[prop]
+	_, field := class.Fields[prop]
+	_, private := class.Private[prop]
+	_, public := class.Public[prop]
+	switch {
+	case write && (getter || public || field && class.PublicFields[prop]):
+		e.ThrowException("property '%s' of class %s is read-only", prop, class.Name)
+	case field:
+		e.ThrowException("field '%s' of class %s is private", prop, class.Name)
+	case private:
+		e.ThrowException("method '%s' of class %s is private", prop, class.Name)
+	}
+	e.ThrowException("class %s has no property '%s'", class.Name, prop)
+}
+
+func (e *Evaluator) setIndex(obj Value, index Value, value Value) {
+	switch obj := obj.(type) {
+	case *Array:
+		index, ok := index.(*Number)
+		if !ok {
+			e.ThrowException("non umber index")
+		}
+		intIndex := int(index.Value)
+		if intIndex < 0 || intIndex >= len(obj.Elements) {
+			e.ThrowException("index out of range")
+		}
+		obj.Elements[intIndex] = value
+	case *Table:
+		existed, err := obj.Pairs.put(e, index, value)
+		if err != nil {
+			e.ThrowException("%s", err.Error())
+		}
+		if !existed {
+			e.alloc(sizeEntry)
+		}
+	case *Instance:
+		method := e.special(obj, SPECIAL_SET_INDEX)
+		if method == nil {
+			e.ThrowException("type not supports index assignment")
+		}
+		e.callValue(method, []Value{index, value})
+	default:
+		e.ThrowException("type not supports index assignment")
+	}
+}
+
 func (e *Evaluator) try(node *parser.TryStatement) Value {
 	_, exc := pkg.Catch[parser.Node, Value, *Exception](e.Eval, node.Try)
-	var excCatch *Exception
-	if exc != nil {
-		oldEnv := e.env
-		e.env = NewEnv(oldEnv)
-		defer func() { e.env = oldEnv }()
-		e.env.Declare(node.As.Value, exc)
-		_, excCatch = pkg.Catch[parser.Node, Value, *Exception](e.Eval, node.Catch)
+	if exc != nil && !exc.Fatal {
+		_, exc = pkg.Catch[*Exception, Value, *Exception](
+			func(exc *Exception) Value { return e.catch(node, exc) },
+			exc,
+		)
+	}
+	if exc != nil && exc.Fatal {
+		panic(exc)
 	}
 	_, excFin := pkg.Catch[parser.Node, Value, *Exception](e.Eval, node.Finally)
 
 	if excFin != nil {
 		panic(excFin)
-	} else if excCatch != nil {
-		panic(excCatch)
+	} else if exc != nil {
+		panic(exc)
 	}
 	return nil
 }
 
+// runs first clause matching exception, rethrows it when none matches
+func (e *Evaluator) catch(node *parser.TryStatement, exc *Exception) Value {
+	value := exc.Value()
+	for _, clause := range node.Catches {
+		if clause.Type != nil {
+			class := e.catchClass(e.Eval(clause.Type))
+			if !e.isInstance(value, class) {
+				continue
+			}
+		}
+		oldEnv := e.env
+		e.env = NewFrame(oldEnv, 1)
+		defer func() { e.env = oldEnv }()
+		e.declare(clause.As, value)
+		return e.Eval(clause.Body)
+	}
+	panic(exc)
+}
+
+func (e *Evaluator) catchClass(value Value) *Class {
+	class, ok := value.(*Class)
+	if !ok {
+		e.ThrowException("catch type is not a class")
+	}
+	return class
+}
+
+// isInstance reports whether value is instance of class, builtin
+// values belong to their default classes
+func (e *Evaluator) isInstance(value Value, class *Class) bool {
+	switch value := value.(type) {
+	case *Instance:
+		return value.Class.extends(class)
+	case *Number:
+		return class == e.defaultClasses[CLASS_NUMBER]
+	case *String:
+		return class == e.defaultClasses[CLASS_STRING]
+	case *Array:
+		return class == e.defaultClasses[CLASS_ARRAY]
+	case *Table:
+		return class == e.defaultClasses[CLASS_TABLE]
+	case *Exception:
+		return class == e.defaultClasses[CLASS_EXCEPTION]
+	}
+	return false
+}
+
 func (e *Evaluator) throw(node *parser.ThrowStatement) Value {
-	e.ThrowException("%s", e.Eval(node.Error).Say())
+	value := e.Eval(node.Error)
+	e.at(node.Span())
+	e.throwValue(value)
 	return nil
 }
 
-func (e Evaluator) prefix(node *parser.PrefixExpression) Value {
+// throwValue raises value as is, caught exceptions keep their trace
+func (e *Evaluator) throwValue(value Value) {
+	if exc, ok := value.(*Exception); ok {
+		panic(exc)
+	}
+	exc := e.exception(describe(value))
+	exc.Payload = value
+	if instance, ok := value.(*Instance); ok {
+		if host, ok := instance.Host.(*Exception); ok {
+			host.StackTrace, host.Excerpt = exc.StackTrace, exc.Excerpt
+		}
+	}
+	panic(exc)
+}
+
+// message of thrown value, instances may provide message field
+func describe(value Value) string {
+	switch value := value.(type) {
+	case *String:
+		return value.Value
+	case *Instance:
+		if host, ok := value.Host.(*Exception); ok {
+			return host.Message
+		}
+		if message, ok := value.Fields["message"].(*String); ok {
+			return message.Value
+		}
+	}
+	return value.Say()
+}
+
+func (e *Evaluator) prefix(node *parser.PrefixExpression) Value {
 	right := e.Eval(node.Right)
-	if node.Operator == parser.OP_NOT {
+	e.at(node.Span())
+	return e.unary(node.Operator, right)
+}
+
+func (e *Evaluator) unary(op parser.Operator, right Value) Value {
+	if op == parser.OP_NOT {
 		return &Boolean{
 			Value: !toBoolean(right),
 		}
 	}
-	if node.Operator == parser.OP_PLUS ||
-		node.Operator == parser.OP_MINUS {
+	if op == parser.OP_PLUS || op == parser.OP_MINUS {
 		if right.Type() != VAL_NUMBER {
 			e.ThrowException("expected number, got %s", right.Type())
 		}
-		if node.Operator == parser.OP_MINUS {
+		if op == parser.OP_MINUS {
 			return &Number{Value: -right.(*Number).Value}
 		} else {
 			return &Number{Value: +right.(*Number).Value}
@@ -414,8 +907,19 @@ type binOp func(Value, Value) (Value, error)
 func (e *Evaluator) infix(node *parser.InfixExpression) Value {
 	left := e.Eval(node.Left)
 	right := e.Eval(node.Right)
+	e.at(node.Span())
+	return e.binary(node.Operator, left, right)
+}
 
-	switch node.Operator {
+func (e *Evaluator) binary(op parser.Operator, left, right Value) Value {
+	if a, ok := left.(*Number); ok {
+		if b, ok := right.(*Number); ok {
+			if res, ok := numBinary(op, a.Value, b.Value); ok {
+				return res
+			}
+		}
+	}
+	switch op {
 	case parser.OP_IS:
 		return &Boolean{Value: right == left}
 	case parser.OP_ISNT:
@@ -431,16 +935,19 @@ func (e *Evaluator) infix(node *parser.InfixExpression) Value {
 		}
 		return left
 	}
+	if res, ok := e.overloaded(op, left, right); ok {
+		return res
+	}
 
 	var f binOp
 	var ok bool
 	switch left.(type) {
 	case *Number:
-		f, ok = numBinOps[node.Operator]
+		f, ok = numBinOps[op]
 	case *String:
-		f, ok = strBinOps[node.Operator]
+		f, ok = strBinOps[op]
 	case *Boolean:
-		f, ok = boolBinOps[node.Operator]
+		f, ok = boolBinOps[op]
 	default:
 		e.ThrowException("unsupported type")
 	}
@@ -451,27 +958,113 @@ func (e *Evaluator) infix(node *parser.InfixExpression) Value {
 	if err != nil {
 		e.ThrowException("%s", err.Error())
 	}
+	if str, ok := res.(*String); ok {
+		e.alloc(len(str.Value))
+	}
 	return res
 }
 
+// reports whether values are equal, numbers, strings and booleans by
+// value, null equals null, instances through __eq, other values only
+// themselves
+func (e *Evaluator) equal(a, b Value) bool {
+	if res, ok := e.overloaded(parser.OP_EQ, a, b); ok {
+		return toBoolean(res)
+	}
+	switch a := a.(type) {
+	case *Number:
+		b, ok := b.(*Number)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	}
+	return a == b
+}
+
+func (e *Evaluator) template(node *parser.TemplateLiteral) Value {
+	parts := []Value{&String{Value: node.Strings[0]}}
+	for i, value := range node.Values {
+		parts = append(parts, e.Eval(value), &String{Value: node.Strings[i+1]})
+	}
+	return e.concat(parts)
+}
+
+// joins texts of values, strings unquoted
+func (e *Evaluator) concat(values []Value) Value {
+	var str strings.Builder
+	for _, value := range values {
+		str.WriteString(e.text(value))
+	}
+	return e.newString(str.String())
+}
+
 func (e *Evaluator) call(
 	node *parser.CallExpression,
 ) Value {
 	left := e.Eval(node.Left)
-	if fun, ok := left.(*Function); ok {
-		return e.callFunction(fun, nil, node.Arguments)
+	args, named := e.arguments(node.Arguments)
+	e.at(node.Span())
+	return e.callValue(left, args, named...)
+}
+
+type namedArg struct {
+	name  string
+	value Value
+}
+
+// evaluates call arguments expanding spread arrays
+func (e *Evaluator) arguments(exprs []parser.Expression) ([]Value, []namedArg) {
+	args := []Value{}
+	var named []namedArg
+	for _, expr := range exprs {
+		switch expr := expr.(type) {
+		case *parser.SpreadExpression:
+			value := e.Eval(expr.Value)
+			e.at(expr.Span())
+			args = append(args, e.spread(value)...)
+		case *parser.NamedArgument:
+			named = append(named, namedArg{expr.Name.Value, e.Eval(expr.Value)})
+		default:
+			args = append(args, e.Eval(expr))
+		}
 	}
-	if method, ok := left.(*Method); ok {
+	return args, named
+}
+
+func (e *Evaluator) spread(value Value) []Value {
+	arr, ok := value.(*Array)
+	if !ok {
+		e.ThrowException("can't spread %s", value.Type())
+	}
+	return arr.Elements
+}
+
+func (e *Evaluator) callValue(callee Value, args []Value, named ...namedArg) Value {
+	if fun, ok := callee.(*Function); ok {
+		return e.callFunction(fun, nil, args, named...)
+	}
+	if method, ok := callee.(*Method); ok {
 		value := e.callFunction(
 			method.Function,
 			method.This,
-			node.Arguments,
+			args,
+			named...,
 		)
 		if method.IsConstructor {
 			return method.This
 		}
 		return value
 	}
+	if method := e.special(callee, SPECIAL_CALL); method != nil {
+		return e.callValue(method, args, named...)
+	}
 	e.ThrowException("not collable")
 	return nil
 }
@@ -479,7 +1072,8 @@ func (e *Evaluator) call(
 func (e *Evaluator) callFunction(
 	fun *Function,
 	this Value,
-	args []parser.Expression,
+	args []Value,
+	named ...namedArg,
 ) (return_ Value) {
 	catchSignal := func() {
 		if r := recover(); r != nil {
@@ -496,34 +1090,29 @@ func (e *Evaluator) callFunction(
 
 	// call native
 	if fun.FType == F_NATIVE {
-		values := e.evalExpressions(args)
-
-		e.callStack.Push(fun)
+		args = e.nativeArgs(fun, args, named)
+		e.pushFrame(&traceFrame{name: fun.Name, native: true})
 		defer e.callStack.Pop()
 
 		defer catchSignal()
-		return fun.Native(e, this, values...)
+		return fun.Native(e, this, args...)
 	}
 
-	// call function
-	if len(fun.Parameters) != len(args) {
-		e.ThrowException(
-			"expected %d arguments, got %d",
-			len(fun.Parameters),
-			len(args),
-		)
+	args = e.bind(fun, args, named)
+
+	// call compiled
+	if fun.FType == F_COMPILED {
+		return e.runFunction(fun, this, args)
 	}
-	values := e.evalExpressions(args)
 
+	// call function
 	oldEnv := e.env
 	defer func() { e.env = oldEnv }()
-	e.env = NewEnv(fun.Closure)
-	e.env.SetThis(this)
-	for i, val := range values {
-		e.env.Declare(fun.Parameters[i], val)
-	}
+	e.env = NewFrame(fun.Closure, fun.Slots)
+	e.env.SetThis(this, fun.Owner)
+	copy(e.env.slots, args)
 
-	e.callStack.Push(fun)
+	e.pushFrame(&traceFrame{name: fun.Name, file: fun.File, span: fun.Span})
 	defer e.callStack.Pop()
 
 	defer catchSignal()
@@ -538,6 +1127,11 @@ func (e *Evaluator) callFunction(
 		}
 	}()
 
+	for i := fun.Required; i < len(fun.Parameters); i++ {
+		if e.env.slots[i] == nil {
+			e.env.slots[i] = e.Eval(fun.Defaults[i])
+		}
+	}
 	for _, stmt := range fun.Body {
 		e.Eval(stmt)
 	}
@@ -545,20 +1139,85 @@ func (e *Evaluator) callFunction(
 	return e.env.globals.Null
 }
 
+// binds arguments of native function declaring parameters, omitted
+// ones get their defaults
+func (e *Evaluator) nativeArgs(fun *Function, args []Value, named []namedArg) []Value {
+	if fun.Parameters == nil && !fun.Rest {
+		if len(named) > 0 {
+			e.ThrowException("unknown argument '%s'", named[0].name)
+		}
+		return args
+	}
+	args = e.bind(fun, args, named)
+	for i, arg := range args {
+		if arg == nil {
+			args[i] = fun.NativeDefaults[i]
+		}
+	}
+	return args
+}
+
+// bind maps arguments to parameter slots, omitted optional parameters
+// stay nil until defaults are evaluated
+func (e *Evaluator) bind(fun *Function, args []Value, named []namedArg) []Value {
+	params := len(fun.Parameters)
+	if len(named) == 0 && !fun.Rest && len(args) == params && fun.Required == params {
+		return args
+	}
+	if len(args) > params && !fun.Rest ||
+		len(named) == 0 && len(args) < fun.Required {
+		e.ThrowException(
+			"expected %s arguments, got %d",
+			fun.arity(),
+			len(args),
+		)
+	}
+
+	slots := make([]Value, params, params+1)
+	positional := min(len(args), params)
+	copy(slots, args[:positional])
+	if fun.Rest {
+		rest := &Array{Elements: slices.Clone(args[positional:])}
+		e.alloc(sizeValue * len(rest.Elements))
+		slots = append(slots, rest)
+	}
+	for _, arg := range named {
+		i := slices.Index(fun.Parameters, arg.name)
+		if i < 0 {
+			e.ThrowException("unknown argument '%s'", arg.name)
+		}
+		if slots[i] != nil {
+			e.ThrowException("argument '%s' given twice", arg.name)
+		}
+		slots[i] = arg.value
+	}
+	for i := range fun.Required {
+		if slots[i] == nil {
+			e.ThrowException("missing argument '%s'", fun.Parameters[i])
+		}
+	}
+	return slots
+}
+
 func (e *Evaluator) property(node *parser.PropertyExpression) Value {
+	_, isThis := node.Left.(*parser.ThisLiteral)
 	left := e.Eval(node.Left)
-	prop := node.Property.Value
+	e.at(node.Span())
+	return e.getProperty(left, node.Property.Value, isThis)
+}
 
+func (e *Evaluator) getProperty(left Value, prop string, isThis bool) Value {
 	switch left := left.(type) {
 	case *Class:
 		ctor, ok := left.Constructors[prop]
 		if !ok {
-			e.ThrowException("missing constructor")
+			e.ThrowException("class %s has no constructor '%s'", left.Name, prop)
 		}
 		this := &Instance{
 			Class:  left,
 			Fields: maps.Clone(left.Fields),
 		}
+		e.alloc(sizeEntry * (len(this.Fields) + 1))
 		method := &Method{
 			Function:      ctor,
 			This:          this,
@@ -566,7 +1225,7 @@ func (e *Evaluator) property(node *parser.PropertyExpression) Value {
 		}
 		return method
 	case *Instance:
-		if _, isThis := node.Left.(*parser.ThisLiteral); isThis {
+		if isThis {
 			value, ok := left.Fields[prop]
 			if ok {
 				return value
@@ -588,10 +1247,16 @@ func (e *Evaluator) property(node *parser.PropertyExpression) Value {
 					IsConstructor: false,
 				}
 			}
-			e.ThrowException("missing field or method")
+			if get, ok := left.Class.Getters[prop]; ok {
+				return e.callFunction(get, left, []Value{})
+			}
+			e.ThrowException("class %s has no field or method '%s'", left.Class.Name, prop)
 		}
 		if get, ok := left.Class.Getters[prop]; ok {
-			return e.callFunction(get, left, []parser.Expression{})
+			return e.callFunction(get, left, []Value{})
+		}
+		if value, ok := left.Fields[prop]; ok && left.Class.PublicFields[prop] {
+			return value
 		}
 		if fun, ok := left.Class.Public[prop]; ok {
 			return &Method{
@@ -600,7 +1265,7 @@ func (e *Evaluator) property(node *parser.PropertyExpression) Value {
 				IsConstructor: false,
 			}
 		}
-		e.ThrowException("missing property")
+		e.throwMissing(left.Class, prop, false)
 	case *String:
 		pub, ok := e.defaultClasses[CLASS_STRING].Public[prop]
 		if ok {
@@ -641,6 +1306,12 @@ func (e *Evaluator) property(node *parser.PropertyExpression) Value {
 			}
 		}
 		e.ThrowException("missing field or method")
+	case *Module:
+		value, err := left.Get(prop)
+		if err != nil {
+			e.ThrowException("%s", err.Error())
+		}
+		return value
 	case *Exception:
 		pub, ok := e.defaultClasses[CLASS_EXCEPTION].Public[prop]
 		if ok {
@@ -659,7 +1330,11 @@ func (e *Evaluator) property(node *parser.PropertyExpression) Value {
 func (e *Evaluator) index(node *parser.IndexExpression) Value {
 	left := e.Eval(node.Left)
 	index := e.Eval(node.Index)
+	e.at(node.Span())
+	return e.getIndex(left, index)
+}
 
+func (e *Evaluator) getIndex(left Value, index Value) Value {
 	switch left := left.(type) {
 	case *Array:
 		if index, ok := index.(*Number); !ok {
@@ -674,12 +1349,33 @@ func (e *Evaluator) index(node *parser.IndexExpression) Value {
 			}
 			return left.Elements[intIndex]
 		}
+	case *String:
+		index, ok := index.(*Number)
+		if !ok {
+			e.ThrowException("non number index")
+		}
+		intIndex := int(index.Value)
+		if index.Value != float64(intIndex) {
+			e.ThrowException("non integer index")
+		}
+		runes := []rune(left.Value)
+		if intIndex < 0 || intIndex >= len(runes) {
+			e.ThrowException("index out of range")
+		}
+		return &String{Value: string(runes[intIndex])}
 	case *Table:
-		val, err := left.Pairs.Get(index)
+		val, ok, err := left.Pairs.lookup(e, index)
 		if err != nil {
 			e.ThrowException("%s", err.Error())
 		}
+		if !ok {
+			e.ThrowException("missing key")
+		}
 		return val
+	case *Instance:
+		if method := e.special(left, SPECIAL_INDEX); method != nil {
+			return e.callValue(method, []Value{index})
+		}
 	}
 	e.ThrowException("type not supports index access")
 	return nil
@@ -689,49 +1385,46 @@ func (e *Evaluator) slice(node *parser.SliceExpression) Value {
 	left := e.Eval(node.Left)
 	start := e.Eval(node.Start)
 	end := e.Eval(node.End)
+	e.at(node.Span())
+	return e.getSlice(left, start, end)
+}
 
+func (e *Evaluator) getSlice(left, start, end Value) Value {
 	switch left := left.(type) {
 	case *Array:
-		start, startOk := start.(*Number)
-		end, endOk := end.(*Number)
-		if !startOk || !endOk {
-			e.ThrowException("non number index")
-		}
-		intStart := int(start.Value)
-		if start.Value != float64(intStart) {
-			e.ThrowException("non integer index")
-		}
-		intEnd := int(end.Value)
-		if end.Value != float64(intEnd) {
-			e.ThrowException("non integer index")
-		}
-		if intStart < 0 || intStart >= len(left.Elements) {
-			e.ThrowException("index out of range")
-		}
-		if intEnd < 0 || intEnd >= len(left.Elements) {
-			e.ThrowException("index out of range")
-		}
-		if intStart > intEnd {
-			e.ThrowException("first index greater then second")
-		}
-		return &Array{Elements: left.Elements[intStart:intEnd]}
+		from, to := e.sliceBounds(start, end, len(left.Elements))
+		return &Array{Elements: left.Elements[from:to]}
+	case *String:
+		runes := []rune(left.Value)
+		from, to := e.sliceBounds(start, end, len(runes))
+		return e.newString(string(runes[from:to]))
 	}
 	e.ThrowException("type not supports index access")
 	return nil
 }
 
-func (e *Evaluator) return_(node *parser.ReturnStatement) Value {
-	panic(&ReturnSignal{Value: e.Eval(node.Value)})
+// integer bounds of slice, end may equal length
+func (e *Evaluator) sliceBounds(start, end Value, length int) (int, int) {
+	startNum, startOk := start.(*Number)
+	endNum, endOk := end.(*Number)
+	if !startOk || !endOk {
+		e.ThrowException("non number index")
+	}
+	from, to := int(startNum.Value), int(endNum.Value)
+	if startNum.Value != float64(from) || endNum.Value != float64(to) {
+		e.ThrowException("non integer index")
+	}
+	if from < 0 || to > length {
+		e.ThrowException("index out of range")
+	}
+	if from > to {
+		e.ThrowException("first index greater then second")
+	}
+	return from, to
 }
 
-func (e *Evaluator) evalExpressions(
-	exprs []parser.Expression,
-) []Value {
-	values := []Value{}
-	for _, expr := range exprs {
-		values = append(values, e.Eval(expr))
-	}
-	return values
+func (e *Evaluator) return_(node *parser.ReturnStatement) Value {
+	panic(&ReturnSignal{Value: e.Eval(node.Value)})
 }
 
 func (e *Evaluator) script(node *parser.Script) Value {
@@ -753,6 +1446,33 @@ func toBoolean(value Value) bool {
 
 /* == bin ops ================================================================*/
 
+// common operators on two numbers without operator table lookup
+func numBinary(op parser.Operator, a, b float64) (Value, bool) {
+	switch op {
+	case parser.OP_PLUS:
+		return &Number{Value: a + b}, true
+	case parser.OP_MINUS:
+		return &Number{Value: a - b}, true
+	case parser.OP_STAR:
+		return &Number{Value: a * b}, true
+	case parser.OP_SLASH:
+		return &Number{Value: a / b}, true
+	case parser.OP_LT:
+		return &Boolean{Value: a < b}, true
+	case parser.OP_LE:
+		return &Boolean{Value: a <= b}, true
+	case parser.OP_GT:
+		return &Boolean{Value: a > b}, true
+	case parser.OP_GE:
+		return &Boolean{Value: a >= b}, true
+	case parser.OP_EQ:
+		return &Boolean{Value: a == b}, true
+	case parser.OP_NE:
+		return &Boolean{Value: a != b}, true
+	}
+	return nil, false
+}
+
 var boolBinOps = map[parser.Operator]binOp{
 	parser.OP_EQ: func(v1, v2 Value) (Value, error) {
 		if v2.Type() != VAL_BOOLEAN {
@@ -814,6 +1534,19 @@ var numBinOps = map[parser.Operator]binOp{
 		}
 		return &Number{Value: v1.(*Number).Value / v2.(*Number).Value}, nil
 	},
+	// remainder takes sign of dividend
+	parser.OP_PERCENT: func(v1, v2 Value) (Value, error) {
+		if v2.Type() != VAL_NUMBER {
+			return nil, errors.New("expected number")
+		}
+		return &Number{Value: math.Mod(v1.(*Number).Value, v2.(*Number).Value)}, nil
+	},
+	parser.OP_POWER: func(v1, v2 Value) (Value, error) {
+		if v2.Type() != VAL_NUMBER {
+			return nil, errors.New("expected number")
+		}
+		return &Number{Value: math.Pow(v1.(*Number).Value, v2.(*Number).Value)}, nil
+	},
 	parser.OP_EQ: func(v1, v2 Value) (Value, error) {
 		if v2.Type() != VAL_NUMBER {
 			return &Boolean{Value: false}, nil
@@ -853,8 +1586,57 @@ var numBinOps = map[parser.Operator]binOp{
 }
 
 func (e *Evaluator) ThrowException(message string, a ...any) {
-	panic(&Exception{
-		Message:    fmt.Sprintf(message, a...),
-		StackTrace: e.callStack.Shot(),
-	})
+	panic(e.exception(fmt.Sprintf(message, a...)))
+}
+
+// exception with current stack trace and excerpt of innermost
+// script position
+func (e *Evaluator) exception(message string) *Exception {
+	exc := &Exception{
+		Message:    message,
+		StackTrace: e.trace(),
+	}
+	if entry, ok := exc.location(); ok {
+		exc.Excerpt = parser.Excerpt(e.sources[entry.File], entry.Span)
+	}
+	return exc
+}
+
+// call of stack trace, compiled frames find span by vm frame ip
+type traceFrame struct {
+	name   string
+	file   string
+	span   parser.Span
+	native bool
+	vm     *frame
+}
+
+// at sets node reached in current call
+func (e *Evaluator) at(span parser.Span) {
+	if top, err := e.callStack.Peek(); err == nil {
+		top.span = span
+	}
+}
+
+func (e *Evaluator) trace() []TraceEntry {
+	frames := e.callStack.Shot()
+	trace := make([]TraceEntry, 0, len(frames))
+	for i := len(frames) - 1; i >= 0; i-- {
+		f := frames[i]
+		span := f.span
+		if f.vm != nil {
+			span = f.vm.code.span(f.vm.ip)
+		}
+		name := f.name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		trace = append(trace, TraceEntry{
+			Function: name,
+			File:     f.file,
+			Span:     span,
+			Native:   f.native,
+		})
+	}
+	return trace
 }
@@ -0,0 +1,151 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// builtin modules, members of core are globals, members of others are
+// reached through global module value of the same name like math.floor
+const (
+	MODULE_CORE   = "core"
+	MODULE_MATH   = "math"
+	MODULE_STRING = "string"
+	MODULE_IO     = "io"
+	MODULE_FS     = "fs"
+	MODULE_OS     = "os"
+	MODULE_TIME   = "time"
+	MODULE_JSON   = "json"
+	MODULE_RANDOM = "random"
+)
+
+var (
+	// PROFILE_PURE has no side effects besides say
+	PROFILE_PURE = []string{
+		MODULE_CORE, MODULE_MATH, MODULE_STRING, MODULE_JSON, MODULE_RANDOM,
+	}
+	// PROFILE_FULL also reads input, files, environment and clock
+	PROFILE_FULL = []string{
+		MODULE_CORE, MODULE_MATH, MODULE_STRING, MODULE_IO,
+		MODULE_FS, MODULE_OS, MODULE_TIME, MODULE_JSON, MODULE_RANDOM,
+	}
+)
+
+var errNoFSRoot = errors.New("module 'fs' needs root directory, set it first")
+
+// native members of builtin module by name
+type library func() map[string]*Function
+
+var libraries = map[string]library{
+	MODULE_CORE:   coreLibrary,
+	MODULE_MATH:   mathLibrary,
+	MODULE_STRING: stringLibrary,
+	MODULE_IO:     ioLibrary,
+	MODULE_FS:     fsLibrary,
+	MODULE_OS:     osLibrary,
+	MODULE_TIME:   timeLibrary,
+	MODULE_JSON:   jsonLibrary,
+	MODULE_RANDOM: randomLibrary,
+}
+
+// constant members of builtin modules
+var libraryConstants = map[string]func() map[string]Value{
+	MODULE_MATH: mathConstants,
+	MODULE_OS:   osConstants,
+}
+
+// LoadModules declares builtin modules, fs requires SetFSRoot
+func (e *Evaluator) LoadModules(names ...string) error {
+	for _, name := range names {
+		lib, ok := libraries[name]
+		if !ok {
+			return fmt.Errorf("unknown builtin module '%s'", name)
+		}
+		if name == MODULE_FS && e.fsRoot == nil {
+			return errNoFSRoot
+		}
+		if name == MODULE_CORE {
+			for member, fun := range lib() {
+				fun.Name = member
+				e.SetBuiltin(member, fun)
+			}
+			continue
+		}
+		env := NewEnv(nil)
+		for member, fun := range lib() {
+			fun.Name = name + "." + member
+			env.Declare(member, fun)
+		}
+		if constants, ok := libraryConstants[name]; ok {
+			for member, value := range constants() {
+				env.Declare(member, value)
+			}
+		}
+		mod := newModule(name, env)
+		mod.Exports = slices.Sorted(maps.Keys(env.store))
+		e.SetBuiltin(name, mod)
+	}
+	return nil
+}
+
+// SetFSRoot confines fs module to dir, paths are relative to it and
+// cannot leave it, absolute paths must lie inside it
+func (e *Evaluator) SetFSRoot(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	root, err := os.OpenRoot(abs)
+	if err != nil {
+		return err
+	}
+	if e.fsRoot != nil {
+		e.fsRoot.Close()
+	}
+	e.fsRoot, e.fsDir = root, abs
+	return nil
+}
+
+// native function checking argument count, arity -1 accepts any
+func native(f NativeFunction, arity int) *Function {
+	return &Function{FType: F_NATIVE, Native: coverNative(f, arity)}
+}
+
+/* == arguments ============================================================= */
+
+func (e *Evaluator) numberArg(args []Value, i int) float64 {
+	num, ok := args[i].(*Number)
+	if !ok {
+		e.ThrowException("argument %d: expected number, got %s", i+1, args[i].Type())
+	}
+	return num.Value
+}
+
+// integer argument, fractional numbers are errors
+func (e *Evaluator) intArg(args []Value, i int) int {
+	num := e.numberArg(args, i)
+	if num != float64(int(num)) {
+		e.ThrowException("argument %d: expected integer, got %g", i+1, num)
+	}
+	return int(num)
+}
+
+func (e *Evaluator) arrayArg(args []Value, i int) *Array {
+	arr, ok := args[i].(*Array)
+	if !ok {
+		e.ThrowException("argument %d: expected array, got %s", i+1, args[i].Type())
+	}
+	return arr
+}
+
+func (e *Evaluator) stringArg(args []Value, i int) string {
+	str, ok := args[i].(*String)
+	if !ok {
+		e.ThrowException("argument %d: expected string, got %s", i+1, args[i].Type())
+	}
+	return str.Value
+}
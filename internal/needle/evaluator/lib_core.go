@@ -0,0 +1,58 @@
+package evaluator
+
+func coreLibrary() map[string]*Function {
+	return map[string]*Function{
+		"class_of":    native(core_class_of, 1),
+		"instance_of": native(core_instance_of, 2),
+		"range":       native(core_range, -1),
+		"len":         native(core_len, 1),
+	}
+}
+
+func core_class_of(e *Evaluator, this Value, args ...Value) Value {
+	if instance, ok := args[0].(*Instance); ok {
+		return instance.Class
+	}
+	return &Null{}
+}
+
+// reports whether value belongs to class or its subclass
+func core_instance_of(e *Evaluator, this Value, args ...Value) Value {
+	class, ok := args[1].(*Class)
+	if !ok {
+		e.ThrowException("argument 2: expected class, got %s", args[1].Type())
+	}
+	return &Boolean{Value: e.isInstance(args[0], class)}
+}
+
+// array of numbers from start up to end exclusive, range(n) counts from 0
+func core_range(e *Evaluator, this Value, args ...Value) Value {
+	if len(args) < 1 || len(args) > 3 {
+		e.ThrowException("expected 1 to 3 arguments, got %d", len(args))
+	}
+	start, end, step := 0.0, e.numberArg(args, 0), 1.0
+	if len(args) > 1 {
+		start, end = end, e.numberArg(args, 1)
+	}
+	if len(args) > 2 {
+		step = e.numberArg(args, 2)
+	}
+	if step == 0 {
+		e.ThrowException("range step is zero")
+	}
+	arr := &Array{Elements: []Value{}}
+	for i := 0; ; i++ {
+		x := start + float64(i)*step
+		if step > 0 && x >= end || step < 0 && x <= end {
+			break
+		}
+		e.alloc(sizeValue)
+		arr.Elements = append(arr.Elements, &Number{Value: x})
+	}
+	return arr
+}
+
+// length of string, array, table or instance defining __len
+func core_len(e *Evaluator, this Value, args ...Value) Value {
+	return &Number{Value: float64(e.length(args[0]))}
+}
@@ -0,0 +1,119 @@
+package evaluator
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+func fsLibrary() map[string]*Function {
+	return map[string]*Function{
+		"read":   native(fs_read, 1),
+		"write":  native(fs_write, 2),
+		"append": native(fs_append, 2),
+		"exists": native(fs_exists, 1),
+		"list": NewNative(
+			fs_list,
+			Param{Name: "dir", Default: &String{Value: "."}},
+		),
+		"remove": native(fs_remove, 1),
+		"mkdir":  native(fs_mkdir, 1),
+	}
+}
+
+// name of path argument inside fs root, paths leaving root are errors
+func (e *Evaluator) fsPath(args []Value, i int) string {
+	path := e.stringArg(args, i)
+	name := filepath.Clean(path)
+	if filepath.IsAbs(name) {
+		rel, err := filepath.Rel(e.fsDir, name)
+		if err != nil {
+			e.ThrowException("path '%s' is outside of fs root", path)
+		}
+		name = rel
+	}
+	if name != "." && !filepath.IsLocal(name) {
+		e.ThrowException("path '%s' is outside of fs root", path)
+	}
+	return name
+}
+
+// throws error of file operation without host directory in message
+func (e *Evaluator) fsError(err error) {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		e.ThrowException("%s %s: %s", pathErr.Op, pathErr.Path, pathErr.Err)
+	}
+	e.ThrowException("%s", err)
+}
+
+func fs_read(e *Evaluator, this Value, args ...Value) Value {
+	data, err := e.fsRoot.ReadFile(e.fsPath(args, 0))
+	if err != nil {
+		e.fsError(err)
+	}
+	e.alloc(len(data))
+	return &String{Value: string(data)}
+}
+
+func fs_write(e *Evaluator, this Value, args ...Value) Value {
+	err := e.fsRoot.WriteFile(e.fsPath(args, 0), []byte(e.stringArg(args, 1)), 0o644)
+	if err != nil {
+		e.fsError(err)
+	}
+	return &Null{}
+}
+
+func fs_append(e *Evaluator, this Value, args ...Value) Value {
+	file, err := e.fsRoot.OpenFile(
+		e.fsPath(args, 0),
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+		0o644,
+	)
+	if err != nil {
+		e.fsError(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(e.stringArg(args, 1)); err != nil {
+		e.fsError(err)
+	}
+	return &Null{}
+}
+
+func fs_exists(e *Evaluator, this Value, args ...Value) Value {
+	_, err := e.fsRoot.Stat(e.fsPath(args, 0))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		e.fsError(err)
+	}
+	return &Boolean{Value: err == nil}
+}
+
+// names of directory entries sorted by name
+func fs_list(e *Evaluator, this Value, args ...Value) Value {
+	entries, err := fs.ReadDir(e.fsRoot.FS(), filepath.ToSlash(e.fsPath(args, 0)))
+	if err != nil {
+		e.fsError(err)
+	}
+	arr := &Array{Elements: make([]Value, len(entries))}
+	for i, entry := range entries {
+		arr.Elements[i] = &String{Value: entry.Name()}
+	}
+	e.alloc(sizeValue * len(entries))
+	return arr
+}
+
+func fs_remove(e *Evaluator, this Value, args ...Value) Value {
+	if err := e.fsRoot.RemoveAll(e.fsPath(args, 0)); err != nil {
+		e.fsError(err)
+	}
+	return &Null{}
+}
+
+// creates directory with missing parents
+func fs_mkdir(e *Evaluator, this Value, args ...Value) Value {
+	if err := e.fsRoot.MkdirAll(e.fsPath(args, 0), 0o755); err != nil {
+		e.fsError(err)
+	}
+	return &Null{}
+}
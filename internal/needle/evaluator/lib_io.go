@@ -0,0 +1,47 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+func ioLibrary() map[string]*Function {
+	return map[string]*Function{
+		"print":     native(io_print, -1),
+		"write":     native(io_write, -1),
+		"read_line": native(io_read_line, 0),
+	}
+}
+
+// writes texts of values separated by spaces and newline
+func io_print(e *Evaluator, this Value, args ...Value) Value {
+	texts := make([]string, len(args))
+	for i, arg := range args {
+		texts[i] = e.text(arg)
+	}
+	fmt.Fprintln(e.out, strings.Join(texts, " "))
+	return &Null{}
+}
+
+// writes texts of values as they are
+func io_write(e *Evaluator, this Value, args ...Value) Value {
+	for _, arg := range args {
+		io.WriteString(e.out, e.text(arg))
+	}
+	return &Null{}
+}
+
+// reads line without line ending, null at end of input
+func io_read_line(e *Evaluator, this Value, args ...Value) Value {
+	line, err := e.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return &Null{}
+		}
+		e.ThrowException("%s", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	e.alloc(len(line))
+	return &String{Value: line}
+}
@@ -0,0 +1,151 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strings"
+)
+
+func jsonLibrary() map[string]*Function {
+	return map[string]*Function{
+		"encode": NewNative(
+			json_encode,
+			Param{Name: "value"},
+			Param{Name: "indent", Default: &String{Value: ""}},
+		),
+		"decode": native(json_decode, 1),
+	}
+}
+
+// json text of null, boolean, number, string, array or table with string
+// keys, tables keep insertion order
+func json_encode(e *Evaluator, this Value, args ...Value) Value {
+	var buf bytes.Buffer
+	e.encodeJSON(&buf, args[0], map[Value]bool{})
+	if indent := e.stringArg(args, 1); indent != "" {
+		var out bytes.Buffer
+		json.Indent(&out, buf.Bytes(), "", indent)
+		buf = out
+	}
+	e.alloc(buf.Len())
+	return &String{Value: buf.String()}
+}
+
+// value of json text, objects become tables in order of keys
+func json_decode(e *Evaluator, this Value, args ...Value) Value {
+	dec := json.NewDecoder(strings.NewReader(e.stringArg(args, 0)))
+	value := e.decodeJSON(dec)
+	if _, err := dec.Token(); err != io.EOF {
+		e.ThrowException("invalid json: unexpected data after value")
+	}
+	return value
+}
+
+func (e *Evaluator) encodeJSON(buf *bytes.Buffer, value Value, seen map[Value]bool) {
+	switch value := value.(type) {
+	case *Null:
+		buf.WriteString("null")
+	case *Boolean:
+		data, _ := json.Marshal(value.Value)
+		buf.Write(data)
+	case *Number:
+		if math.IsNaN(value.Value) || math.IsInf(value.Value, 0) {
+			e.ThrowException("cannot encode %s to json", value.Say())
+		}
+		data, _ := json.Marshal(value.Value)
+		buf.Write(data)
+	case *String:
+		data, _ := json.Marshal(value.Value)
+		buf.Write(data)
+	case *Array:
+		e.enterJSON(value, seen)
+		defer delete(seen, value)
+		buf.WriteByte('[')
+		for i, elem := range value.Elements {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			e.encodeJSON(buf, elem, seen)
+		}
+		buf.WriteByte(']')
+	case *Table:
+		e.enterJSON(value, seen)
+		defer delete(seen, value)
+		buf.WriteByte('{')
+		for i, entry := range value.Pairs.Entries() {
+			key, ok := entry.Key.(*String)
+			if !ok {
+				e.ThrowException("cannot encode table key of type %s to json", entry.Key.Type())
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			e.encodeJSON(buf, key, seen)
+			buf.WriteByte(':')
+			e.encodeJSON(buf, entry.Value, seen)
+		}
+		buf.WriteByte('}')
+	default:
+		e.ThrowException("cannot encode %s to json", value.Type())
+	}
+}
+
+// marks container as being encoded, throws on cycle
+func (e *Evaluator) enterJSON(value Value, seen map[Value]bool) {
+	if seen[value] {
+		e.ThrowException("cannot encode cyclic %s to json", value.Type())
+	}
+	seen[value] = true
+}
+
+func (e *Evaluator) decodeJSON(dec *json.Decoder) Value {
+	token, err := dec.Token()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		e.ThrowException("invalid json: %s", err)
+	}
+	switch token := token.(type) {
+	case nil:
+		return &Null{}
+	case bool:
+		return &Boolean{Value: token}
+	case float64:
+		return &Number{Value: token}
+	case string:
+		e.alloc(len(token))
+		return &String{Value: token}
+	case json.Delim:
+		if token == '[' {
+			arr := &Array{Elements: []Value{}}
+			for dec.More() {
+				arr.Elements = append(arr.Elements, e.decodeJSON(dec))
+			}
+			e.closeJSON(dec)
+			e.alloc(sizeValue * len(arr.Elements))
+			return arr
+		}
+		table := &Table{Pairs: NewHashTable()}
+		for dec.More() {
+			key := e.decodeJSON(dec)
+			e.tableSet(table, key, e.decodeJSON(dec))
+		}
+		e.closeJSON(dec)
+		return table
+	}
+	panic("unreachable")
+}
+
+// consumes closing delimiter of array or object
+func (e *Evaluator) closeJSON(dec *json.Decoder) {
+	if _, err := dec.Token(); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		e.ThrowException("invalid json: %s", err)
+	}
+}
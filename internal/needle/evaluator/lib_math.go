@@ -0,0 +1,107 @@
+package evaluator
+
+import "math"
+
+func mathLibrary() map[string]*Function {
+	return map[string]*Function{
+		"abs":    mathFunction(math.Abs),
+		"floor":  mathFunction(math.Floor),
+		"ceil":   mathFunction(math.Ceil),
+		"round":  mathFunction(math.Round),
+		"trunc":  mathFunction(math.Trunc),
+		"sqrt":   mathFunction(math.Sqrt),
+		"sin":    mathFunction(math.Sin),
+		"cos":    mathFunction(math.Cos),
+		"tan":    mathFunction(math.Tan),
+		"pow":    native(math_pow, 2),
+		"log":    NewNative(math_log, Param{Name: "x"}, Param{Name: "base", Default: &Null{}}),
+		"div":    native(math_div, 2),
+		"min":    native(math_min, -1),
+		"max":    native(math_max, -1),
+		"clamp":  native(math_clamp, 3),
+		"is_nan": mathPredicate(math.IsNaN),
+		"is_inf": mathPredicate(func(x float64) bool { return math.IsInf(x, 0) }),
+		"is_int": mathPredicate(func(x float64) bool { return x == math.Trunc(x) }),
+	}
+}
+
+func mathConstants() map[string]Value {
+	return map[string]Value{
+		"pi":  &Number{Value: math.Pi},
+		"e":   &Number{Value: math.E},
+		"inf": &Number{Value: math.Inf(1)},
+		"nan": &Number{Value: math.NaN()},
+	}
+}
+
+// native function of one number
+func mathFunction(f func(float64) float64) *Function {
+	return native(func(e *Evaluator, this Value, args ...Value) Value {
+		return &Number{Value: f(e.numberArg(args, 0))}
+	}, 1)
+}
+
+// native check of one number
+func mathPredicate(f func(float64) bool) *Function {
+	return native(func(e *Evaluator, this Value, args ...Value) Value {
+		return &Boolean{Value: f(e.numberArg(args, 0))}
+	}, 1)
+}
+
+func math_pow(e *Evaluator, this Value, args ...Value) Value {
+	return &Number{Value: math.Pow(e.numberArg(args, 0), e.numberArg(args, 1))}
+}
+
+// natural logarithm or logarithm to base
+func math_log(e *Evaluator, this Value, args ...Value) Value {
+	x := e.numberArg(args, 0)
+	if _, ok := args[1].(*Null); ok {
+		return &Number{Value: math.Log(x)}
+	}
+	base := e.numberArg(args, 1)
+	switch base {
+	case 2:
+		return &Number{Value: math.Log2(x)}
+	case 10:
+		return &Number{Value: math.Log10(x)}
+	}
+	return &Number{Value: math.Log(x) / math.Log(base)}
+}
+
+// integer division truncating toward zero, a == div(a, b) * b + a % b
+func math_div(e *Evaluator, this Value, args ...Value) Value {
+	divisor := e.numberArg(args, 1)
+	if divisor == 0 {
+		e.ThrowException("division by zero")
+	}
+	return &Number{Value: math.Trunc(e.numberArg(args, 0) / divisor)}
+}
+
+func math_min(e *Evaluator, this Value, args ...Value) Value {
+	return &Number{Value: e.fold(args, math.Min)}
+}
+
+func math_max(e *Evaluator, this Value, args ...Value) Value {
+	return &Number{Value: e.fold(args, math.Max)}
+}
+
+// x limited to range from low to high
+func math_clamp(e *Evaluator, this Value, args ...Value) Value {
+	x, low, high := e.numberArg(args, 0), e.numberArg(args, 1), e.numberArg(args, 2)
+	if low > high {
+		e.ThrowException("clamp range %g to %g is empty", low, high)
+	}
+	return &Number{Value: math.Max(low, math.Min(x, high))}
+}
+
+// folds at least one number argument
+func (e *Evaluator) fold(args []Value, f func(float64, float64) float64) float64 {
+	if len(args) == 0 {
+		e.ThrowException("expected at least 1 arguments, got 0")
+	}
+	result := e.numberArg(args, 0)
+	for i := 1; i < len(args); i++ {
+		result = f(result, e.numberArg(args, i))
+	}
+	return result
+}
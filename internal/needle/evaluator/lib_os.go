@@ -0,0 +1,36 @@
+package evaluator
+
+import (
+	"os"
+	"runtime"
+)
+
+func osLibrary() map[string]*Function {
+	return map[string]*Function{
+		"env": native(os_env, 1),
+		"cwd": native(os_cwd, 0),
+	}
+}
+
+func osConstants() map[string]Value {
+	return map[string]Value{
+		"platform": &String{Value: runtime.GOOS},
+	}
+}
+
+// value of environment variable, null when unset
+func os_env(e *Evaluator, this Value, args ...Value) Value {
+	value, ok := os.LookupEnv(e.stringArg(args, 0))
+	if !ok {
+		return &Null{}
+	}
+	return &String{Value: value}
+}
+
+func os_cwd(e *Evaluator, this Value, args ...Value) Value {
+	dir, err := os.Getwd()
+	if err != nil {
+		e.ThrowException("%s", err)
+	}
+	return &String{Value: dir}
+}
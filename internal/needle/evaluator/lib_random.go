@@ -0,0 +1,64 @@
+package evaluator
+
+import "math/rand/v2"
+
+func randomLibrary() map[string]*Function {
+	return map[string]*Function{
+		"float":   native(random_float, 0),
+		"int":     native(random_int, 2),
+		"seed":    native(random_seed, 1),
+		"choice":  native(random_choice, 1),
+		"shuffle": native(random_shuffle, 1),
+	}
+}
+
+// generator of random module, randomly seeded until random.seed
+func (e *Evaluator) random() *rand.Rand {
+	if e.rand == nil {
+		e.rand = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	return e.rand
+}
+
+// number in [0, 1)
+func random_float(e *Evaluator, this Value, args ...Value) Value {
+	return &Number{Value: e.random().Float64()}
+}
+
+// integer from a to b inclusive
+func random_int(e *Evaluator, this Value, args ...Value) Value {
+	a, b := e.intArg(args, 0), e.intArg(args, 1)
+	if a > b {
+		e.ThrowException("random range %d to %d is empty", a, b)
+	}
+	// wider spans overflow and cannot be told apart as numbers anyway
+	span := uint64(b) - uint64(a)
+	if span > 1<<53 {
+		e.ThrowException("random range %d to %d is too wide", a, b)
+	}
+	return &Number{Value: float64(a + int(e.random().Uint64N(span+1)))}
+}
+
+// makes following results repeat for the same seed
+func random_seed(e *Evaluator, this Value, args ...Value) Value {
+	seed := uint64(e.intArg(args, 0))
+	e.rand = rand.New(rand.NewPCG(seed, seed))
+	return &Null{}
+}
+
+func random_choice(e *Evaluator, this Value, args ...Value) Value {
+	arr := e.arrayArg(args, 0)
+	if len(arr.Elements) == 0 {
+		e.ThrowException("cannot choose from empty array")
+	}
+	return arr.Elements[e.random().IntN(len(arr.Elements))]
+}
+
+// shuffles array in place and returns it
+func random_shuffle(e *Evaluator, this Value, args ...Value) Value {
+	arr := e.arrayArg(args, 0)
+	e.random().Shuffle(len(arr.Elements), func(i, j int) {
+		arr.Elements[i], arr.Elements[j] = arr.Elements[j], arr.Elements[i]
+	})
+	return arr
+}
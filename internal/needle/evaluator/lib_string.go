@@ -0,0 +1,57 @@
+package evaluator
+
+import (
+	"strings"
+	"unicode"
+)
+
+func stringLibrary() map[string]*Function {
+	return map[string]*Function{
+		"from":      native(string_from, 1),
+		"format":    native(string_format, -1),
+		"from_code": native(string_from_code, -1),
+	}
+}
+
+// text of any value, strings unquoted
+func string_from(e *Evaluator, this Value, args ...Value) Value {
+	return &String{Value: e.text(args[0])}
+}
+
+// string of characters with given code points
+func string_from_code(e *Evaluator, this Value, args ...Value) Value {
+	runes := make([]rune, len(args))
+	for i := range args {
+		code := e.intArg(args, i)
+		if code < 0 || code > unicode.MaxRune {
+			e.ThrowException("argument %d: invalid code point %d", i+1, code)
+		}
+		runes[i] = rune(code)
+	}
+	return e.newString(string(runes))
+}
+
+// replaces each {} of template with text of next argument
+func string_format(e *Evaluator, this Value, args ...Value) Value {
+	if len(args) == 0 {
+		e.ThrowException("expected at least 1 arguments, got 0")
+	}
+	template := e.stringArg(args, 0)
+	rest := args[1:]
+	var str strings.Builder
+	for {
+		before, after, found := strings.Cut(template, "{}")
+		str.WriteString(before)
+		if !found {
+			break
+		}
+		if len(rest) == 0 {
+			e.ThrowException("not enough arguments for template")
+		}
+		str.WriteString(e.text(rest[0]))
+		rest = rest[1:]
+		template = after
+	}
+	e.alloc(str.Len())
+	return &String{Value: str.String()}
+}
@@ -0,0 +1,41 @@
+package evaluator
+
+import "time"
+
+// process start, origin of time.clock
+var clockStart = time.Now()
+
+func timeLibrary() map[string]*Function {
+	return map[string]*Function{
+		"clock": native(time_clock, 0),
+		"now":   native(time_now, 0),
+		"sleep": native(time_sleep, 1),
+	}
+}
+
+// monotonic seconds for measuring durations
+func time_clock(e *Evaluator, this Value, args ...Value) Value {
+	return &Number{Value: time.Since(clockStart).Seconds()}
+}
+
+// seconds since unix epoch
+func time_now(e *Evaluator, this Value, args ...Value) Value {
+	return &Number{Value: float64(time.Now().UnixNano()) / float64(time.Second)}
+}
+
+// sleeps, cancelled run wakes up and aborts
+func time_sleep(e *Evaluator, this Value, args ...Value) Value {
+	d := time.Duration(e.numberArg(args, 0) * float64(time.Second))
+	if e.ctx == nil {
+		time.Sleep(d)
+		return &Null{}
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-e.ctx.Done():
+		e.abort(e.ctx.Err())
+	}
+	return &Null{}
+}
@@ -0,0 +1,112 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"needle/internal/needle/parser"
+)
+
+// causes of exceptions raised by exceeded limits, step and memory limits
+// and cancellation are fatal: try neither catches them nor runs finally
+var (
+	ErrStepLimit   = errors.New("step limit exceeded")
+	ErrMemoryLimit = errors.New("memory limit exceeded")
+	ErrCallDepth   = errors.New("call depth exceeded")
+)
+
+// Limits bounds single Run or host Call, zero field means unlimited.
+// Steps counts evaluated nodes or executed instructions, the latter in
+// batches, so vm may run few instructions past the limit, Memory
+// approximates bytes allocated by strings, arrays, tables and instances
+type Limits struct {
+	Steps     int
+	CallDepth int
+	Memory    int
+}
+
+// DefaultLimits keep deep recursion from overflowing Go stack
+var DefaultLimits = Limits{CallDepth: 10_000}
+
+// approximate sizes used by memory limit
+const (
+	sizeValue = 16
+	sizeEntry = 48
+)
+
+// cancellation is checked once per this many steps
+const cancelCheckSteps = 1024
+
+// vm counts this many instructions at once
+const stepBatch = 64
+
+// SetLimits replaces execution limits, DefaultLimits initially
+func (e *Evaluator) SetLimits(limits Limits) {
+	e.limits = limits
+}
+
+// RunContext runs script like Run, aborting it when ctx is done
+func (e *Evaluator) RunContext(ctx context.Context, script *parser.Script) error {
+	old := e.ctx
+	e.ctx = ctx
+	defer func() { e.ctx = old }()
+	return e.Run(script)
+}
+
+// resets budgets when entering from host
+func (e *Evaluator) startBudget() {
+	if e.callStack.Length() == 0 {
+		e.steps, e.allocated = 0, 0
+	}
+}
+
+// counts step, aborts on exhausted step budget or done context
+func (e *Evaluator) step() {
+	e.steps++
+	if e.limits.Steps > 0 && e.steps > e.limits.Steps {
+		e.abort(ErrStepLimit)
+	}
+	if e.ctx != nil && e.steps%cancelCheckSteps == 1 {
+		if err := e.ctx.Err(); err != nil {
+			e.abort(err)
+		}
+	}
+}
+
+// counts n steps at once, vm reports its instructions in batches
+func (e *Evaluator) stepMany(n int) {
+	e.steps += n
+	if e.limits.Steps > 0 && e.steps > e.limits.Steps {
+		e.abort(ErrStepLimit)
+	}
+	if e.ctx != nil && (e.steps-1)%cancelCheckSteps < n {
+		if err := e.ctx.Err(); err != nil {
+			e.abort(err)
+		}
+	}
+}
+
+// counts allocated bytes, aborts on exhausted memory budget
+func (e *Evaluator) alloc(bytes int) {
+	e.allocated += bytes
+	if e.limits.Memory > 0 && e.allocated > e.limits.Memory {
+		e.abort(ErrMemoryLimit)
+	}
+}
+
+// pushFrame enters call, too deep call throws catchable exception
+func (e *Evaluator) pushFrame(f *traceFrame) {
+	if e.limits.CallDepth > 0 && e.callStack.Length() >= e.limits.CallDepth {
+		exc := e.exception(ErrCallDepth.Error())
+		exc.Cause = ErrCallDepth
+		panic(exc)
+	}
+	e.callStack.Push(f)
+}
+
+// throws fatal exception caused by err
+func (e *Evaluator) abort(err error) {
+	exc := e.exception(err.Error())
+	exc.Cause = err
+	exc.Fatal = true
+	panic(exc)
+}
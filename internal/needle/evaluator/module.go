@@ -0,0 +1,246 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"needle/internal/needle/lexer"
+	"needle/internal/needle/parser"
+	"needle/internal/needle/resolver"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const moduleExt = ".ndl"
+
+type moduleLoader struct {
+	searchPath []string
+	mainDir    string
+	cache      map[string]*Module
+	loading    []string
+}
+
+func newModuleLoader() *moduleLoader {
+	return &moduleLoader{
+		searchPath: []string{},
+		cache:      map[string]*Module{},
+		loading:    []string{},
+	}
+}
+
+// SetSearchPath sets directories used to resolve non-relative imports
+func (e *Evaluator) SetSearchPath(paths []string) {
+	e.modules.searchPath = slices.Clone(paths)
+}
+
+var errNoImports = errors.New("imports need filesystem access, host granted none")
+
+// directories modules are read from: fs root, directory of main script
+// and search path, empty when host gave script no filesystem access
+func (e *Evaluator) importDirs() []string {
+	dirs := []string{}
+	if e.fsRoot != nil {
+		dirs = append(dirs, e.fsDir)
+	}
+	if e.modules.mainDir != "" {
+		dirs = append(dirs, e.modules.mainDir)
+	}
+	for _, dir := range e.modules.searchPath {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dirs = append(dirs, abs)
+		}
+	}
+	return dirs
+}
+
+// file relative to first of dirs containing it
+func within(dirs []string, file string) (dir, rel string, ok bool) {
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(dir, file)
+		if err == nil && filepath.IsLocal(rel) {
+			return dir, rel, true
+		}
+	}
+	return "", "", false
+}
+
+// reads module through root of import directory, so symbolic links
+// cannot lead out of it
+func readModule(dirs []string, file string) ([]byte, error) {
+	dir, rel, ok := within(dirs, file)
+	if !ok {
+		return nil, fmt.Errorf("module \"%s\" is outside of import directories", file)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	return root.ReadFile(rel)
+}
+
+// resolves import path relative to importing module directory,
+// then against search path, only files inside dirs are considered
+func (ml *moduleLoader) resolve(path string, from string, dirs []string) (string, error) {
+	candidates := []string{}
+	if filepath.IsAbs(path) {
+		candidates = append(candidates, path)
+	} else if strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") {
+		candidates = append(candidates, filepath.Join(from, path))
+	} else {
+		candidates = append(candidates, filepath.Join(from, path))
+		for _, dir := range ml.searchPath {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+	outside := false
+	for _, candidate := range candidates {
+		for _, file := range []string{candidate, candidate + moduleExt} {
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				return "", err
+			}
+			if _, _, ok := within(dirs, abs); !ok {
+				outside = true
+				continue
+			}
+			info, err := os.Stat(abs)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			return abs, nil
+		}
+	}
+	if outside {
+		return "", fmt.Errorf("module \"%s\" is outside of import directories", path)
+	}
+	return "", fmt.Errorf("module \"%s\" not found", path)
+}
+
+// registers main script as module being loaded, returns exit function
+func (e *Evaluator) enterMain(file string) func() {
+	if file == "" {
+		e.module = newModule(file, e.env)
+		return func() {}
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	e.module = newModule(file, e.env)
+	e.modules.mainDir = filepath.Dir(file)
+	e.modules.loading = append(e.modules.loading, file)
+	return func() {
+		e.modules.loading = e.modules.loading[:len(e.modules.loading)-1]
+		e.modules.cache[file] = e.module
+	}
+}
+
+func (e *Evaluator) import_(node *parser.ImportStatement) Value {
+	mod := e.loadModule(node.Path.Value)
+	if node.Alias != nil {
+		if err := e.env.Declare(node.Alias.Value, mod); err != nil {
+			e.ThrowException("%s", err.Error())
+		}
+		return nil
+	}
+	if node.Names != nil {
+		for _, name := range node.Names {
+			value, err := mod.Get(name.Name.Value)
+			if err != nil {
+				e.ThrowException("%s", err.Error())
+			}
+			if err := e.env.Declare(name.Alias.Value, value); err != nil {
+				e.ThrowException("%s", err.Error())
+			}
+		}
+		return nil
+	}
+	for _, name := range mod.Exports {
+		value, _ := mod.Get(name)
+		if err := e.env.Declare(name, value); err != nil {
+			e.ThrowException("%s", err.Error())
+		}
+	}
+	return nil
+}
+
+func (e *Evaluator) export(node *parser.ExportStatement) Value {
+	names := node.Names
+	if node.Declaration != nil {
+		e.Eval(node.Declaration)
+		names = []*parser.IdentifierLiteral{node.Declaration.Identifier}
+	}
+	for _, name := range names {
+		e.exportName(name.Value)
+	}
+	return nil
+}
+
+func (e *Evaluator) exportName(name string) {
+	if _, err := e.env.Get(name); err != nil {
+		e.ThrowException("%s", err.Error())
+	}
+	if slices.Contains(e.module.Exports, name) {
+		e.ThrowException("'%s' already exported", name)
+	}
+	e.module.Exports = append(e.module.Exports, name)
+}
+
+// evaluates module once and caches it by resolved path
+func (e *Evaluator) loadModule(path string) *Module {
+	from, err := os.Getwd()
+	if err != nil {
+		e.ThrowException("%s", err.Error())
+	}
+	if e.module.Path != "" {
+		from = filepath.Dir(e.module.Path)
+	}
+	dirs := e.importDirs()
+	if len(dirs) == 0 {
+		e.ThrowException("import \"%s\": %s", path, errNoImports)
+	}
+	resolved, err := e.modules.resolve(path, from, dirs)
+	if err != nil {
+		e.ThrowException("%s", err.Error())
+	}
+	if mod, ok := e.modules.cache[resolved]; ok {
+		return mod
+	}
+	if i := slices.Index(e.modules.loading, resolved); i >= 0 {
+		cycle := append(slices.Clone(e.modules.loading[i:]), resolved)
+		e.ThrowException("import cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	source, err := readModule(dirs, resolved)
+	if err != nil {
+		e.ThrowException("%s", err.Error())
+	}
+	script, errs := parser.New(lexer.New([]rune(string(source)))).Parse()
+	if errs == nil {
+		errs = resolver.New(e.builtinDefined).Resolve(script)
+	}
+	if errs != nil {
+		e.ThrowException(
+			"import \"%s\": %s",
+			path,
+			errors.Join(errs...).Error(),
+		)
+	}
+	script.File = resolved
+	script.Source = string(source)
+
+	oldEnv, oldModule := e.env, e.module
+	e.env = NewEnv(e.builtins)
+	e.module = newModule(resolved, e.env)
+	e.modules.loading = append(e.modules.loading, resolved)
+	defer func() {
+		e.env, e.module = oldEnv, oldModule
+		e.modules.loading = e.modules.loading[:len(e.modules.loading)-1]
+	}()
+
+	mod := e.module
+	e.exec(script)
+	e.modules.cache[resolved] = mod
+	return mod
+}
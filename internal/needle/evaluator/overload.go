@@ -0,0 +1,135 @@
+package evaluator
+
+import "needle/internal/needle/parser"
+
+// special methods classes define to overload operators and builtins
+const (
+	SPECIAL_INDEX     = "__index"
+	SPECIAL_SET_INDEX = "__set_index"
+	SPECIAL_CALL      = "__call"
+	SPECIAL_STR       = "__str"
+	SPECIAL_LEN       = "__len"
+)
+
+// special method of left operand, != uses __eq
+var operatorMethods = map[parser.Operator]string{
+	parser.OP_PLUS:    "__add",
+	parser.OP_MINUS:   "__sub",
+	parser.OP_STAR:    "__mul",
+	parser.OP_SLASH:   "__div",
+	parser.OP_PERCENT: "__mod",
+	parser.OP_POWER:   "__pow",
+	parser.OP_EQ:      "__eq",
+	parser.OP_LT:      "__lt",
+	parser.OP_LE:      "__le",
+	parser.OP_GT:      "__gt",
+	parser.OP_GE:      "__ge",
+}
+
+// special method of right operand tried when left one has none,
+// comparisons swap sides: a < b is b > a
+var reflectedMethods = map[parser.Operator]string{
+	parser.OP_PLUS:    "__radd",
+	parser.OP_MINUS:   "__rsub",
+	parser.OP_STAR:    "__rmul",
+	parser.OP_SLASH:   "__rdiv",
+	parser.OP_PERCENT: "__rmod",
+	parser.OP_POWER:   "__rpow",
+	parser.OP_EQ:      "__eq",
+	parser.OP_LT:      "__gt",
+	parser.OP_LE:      "__ge",
+	parser.OP_GT:      "__lt",
+	parser.OP_GE:      "__le",
+}
+
+// public method name of instance, nil for other values
+func (e *Evaluator) special(value Value, name string) *Method {
+	instance, ok := value.(*Instance)
+	if !ok {
+		return nil
+	}
+	fun, ok := instance.Class.Public[name]
+	if !ok {
+		return nil
+	}
+	return &Method{Function: fun, This: instance}
+}
+
+// applies operator overloaded by either operand, == and != compare
+// instances by identity when neither defines __eq
+func (e *Evaluator) overloaded(op parser.Operator, left, right Value) (Value, bool) {
+	_, leftInstance := left.(*Instance)
+	_, rightInstance := right.(*Instance)
+	if !leftInstance && !rightInstance {
+		return nil, false
+	}
+	negate := op == parser.OP_NE
+	if negate {
+		op = parser.OP_EQ
+	}
+	name, ok := operatorMethods[op]
+	if !ok {
+		return nil, false
+	}
+	var result Value
+	if method := e.special(left, name); method != nil {
+		result = e.callValue(method, []Value{right})
+	} else if method := e.special(right, reflectedMethods[op]); method != nil {
+		result = e.callValue(method, []Value{left})
+	} else if op == parser.OP_EQ {
+		result = &Boolean{Value: left == right}
+	} else if leftInstance {
+		e.ThrowException(
+			"class %s does not define %s for operator %s",
+			left.(*Instance).Class.Name, name, op,
+		)
+	} else {
+		return nil, false
+	}
+	if op == parser.OP_EQ {
+		return &Boolean{Value: toBoolean(result) != negate}, true
+	}
+	return result, true
+}
+
+// text of value, strings unquoted, instances through __str
+func (e *Evaluator) text(value Value) string {
+	if str, ok := value.(*String); ok {
+		return str.Value
+	}
+	return e.show(value)
+}
+
+// shown form of value as say prints it, instances through __str
+func (e *Evaluator) show(value Value) string {
+	method := e.special(value, SPECIAL_STR)
+	if method == nil {
+		return value.Say()
+	}
+	str, ok := e.callValue(method, nil).(*String)
+	if !ok {
+		e.ThrowException("%s.%s must return string", method.This.(*Instance).Class.Name, SPECIAL_STR)
+	}
+	return str.Value
+}
+
+// length of string in characters, array, table or instance through __len
+func (e *Evaluator) length(value Value) int {
+	switch value := value.(type) {
+	case *String:
+		return len([]rune(value.Value))
+	case *Array:
+		return len(value.Elements)
+	case *Table:
+		return value.Pairs.Size()
+	}
+	method := e.special(value, SPECIAL_LEN)
+	if method == nil {
+		e.ThrowException("%s has no length", value.Type())
+	}
+	num, ok := e.callValue(method, nil).(*Number)
+	if !ok || num.Value != float64(int(num.Value)) || num.Value < 0 {
+		e.ThrowException("%s.%s must return non negative integer", method.This.(*Instance).Class.Name, SPECIAL_LEN)
+	}
+	return int(num.Value)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"needle/internal/needle/parser"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -26,6 +27,7 @@ type Signal interface {
 const (
 	F_FUNCTION FType = "function"
 	F_NATIVE   FType = "native"
+	F_COMPILED FType = "compiled"
 )
 
 const (
@@ -46,6 +48,8 @@ const (
 	VAL_CLASS     ValueType = "class"
 	VAL_ARRAY     ValueType = "array"
 	VAL_TABLE     ValueType = "table"
+	VAL_MODULE    ValueType = "module"
+	VAL_ITERATOR  ValueType = "iterator"
 )
 
 type ReturnSignal struct {
@@ -100,12 +104,37 @@ func (s *String) Say() string {
 	return fmt.Sprintf("\"%s\"", s.Value)
 }
 
+// parameters after Required ones are optional, Rest adds slot after
+// parameters collecting extra arguments into array
 type Function struct {
-	FType      FType
-	Parameters []string
-	Body       []parser.Statement
-	Native     NativeFunction
-	Closure    *Env
+	FType          FType
+	Name           string
+	File           string
+	Span           parser.Span
+	Parameters     []string
+	Required       int
+	Rest           bool
+	Defaults       []parser.Expression
+	NativeDefaults []Value
+	Body           []parser.Statement
+	Native         NativeFunction
+	Code           *Code
+	Closure        *Env
+	Slots          int
+	// class declaring method, super refers to its parent
+	Owner *Class
+}
+
+// describes accepted argument count for error messages
+func (f *Function) arity() string {
+	switch {
+	case f.Rest:
+		return fmt.Sprintf("at least %d", f.Required)
+	case f.Required < len(f.Parameters):
+		return fmt.Sprintf("%d to %d", f.Required, len(f.Parameters))
+	default:
+		return strconv.Itoa(len(f.Parameters))
+	}
 }
 
 func (f *Function) Type() ValueType {
@@ -128,8 +157,13 @@ func (m *Method) Say() string {
 	return fmt.Sprintf("<function %p>", m)
 }
 
+// Class holds members inherited from Parent unless it overrides them,
+// Fields are private unless named in PublicFields
 type Class struct {
+	Name         string
+	Parent       *Class
 	Fields       map[string]Value
+	PublicFields map[string]bool
 	Constructors map[string]*Function
 	Public       map[string]*Function
 	Private      map[string]*Function
@@ -142,9 +176,12 @@ func (c *Class) Say() string {
 	return fmt.Sprintf("<class %p>", c)
 }
 
+// Host holds Go value wrapped by instance of native class, scripts
+// cannot reach it
 type Instance struct {
 	Class  *Class
 	Fields map[string]Value
+	Host   any
 }
 
 func (i *Instance) Type() ValueType { return VAL_FUNCTION }
@@ -152,9 +189,71 @@ func (i *Instance) Say() string {
 	return fmt.Sprintf("<instance %p of class %p>", i, i.Class)
 }
 
+// Iterator walks array, table or string for loop, keyed iterators
+// bind key when loop has single variable
+type Iterator struct {
+	next  func() (Value, Value, bool)
+	keyed bool
+}
+
+func (it *Iterator) Type() ValueType { return VAL_ITERATOR }
+func (it *Iterator) Say() string {
+	return fmt.Sprintf("<iterator %p>", it)
+}
+
+// Next returns count loop variables or false when iterator is exhausted
+func (it *Iterator) Next(count int) ([]Value, bool) {
+	key, value, ok := it.next()
+	switch {
+	case !ok:
+		return nil, false
+	case count == 2:
+		return []Value{key, value}, true
+	case it.keyed:
+		return []Value{key}, true
+	default:
+		return []Value{value}, true
+	}
+}
+
+// TraceEntry is one call of exception stack trace, Span is zero
+// when position is unknown
+type TraceEntry struct {
+	Function string
+	File     string
+	Span     parser.Span
+	Native   bool
+}
+
+func (t TraceEntry) String() string {
+	if t.Native {
+		return fmt.Sprintf("at %s (native)", t.Function)
+	}
+	return fmt.Sprintf("at %s (%s)", t.Function, t.location())
+}
+
+func (t TraceEntry) location() string {
+	file := t.File
+	if file == "" {
+		file = "<input>"
+	}
+	if t.Span.Start.Line == 0 {
+		return file
+	}
+	return fmt.Sprintf("%s:%s", file, t.Span.Start)
+}
+
+// Exception carries thrown Payload, it is nil for runtime errors,
+// StackTrace starts from innermost call, Excerpt underlines source
+// of innermost script position, Cause is set for exceeded limits and
+// cancellation, Fatal exceptions cannot be caught
 type Exception struct {
 	Message    string
-	StackTrace []*Function
+	Payload    Value
+	StackTrace []TraceEntry
+	Excerpt    string
+	Cause      error
+	Fatal      bool
 }
 
 func (e *Exception) Type() ValueType { return VAL_EXCEPTION }
@@ -162,17 +261,54 @@ func (e *Exception) Say() string {
 	return fmt.Sprintf("<exception %p>", e)
 }
 func (e *Exception) Error() string {
-	var trace strings.Builder
-	for _, fun := range e.StackTrace {
-		trace.WriteString("\t")
-		trace.WriteString(fun.Say())
-		trace.WriteString("\n")
+	var str strings.Builder
+	if entry, ok := e.location(); ok {
+		str.WriteString(entry.location())
+		str.WriteString(": ")
+	}
+	str.WriteString(e.Message)
+	if e.Excerpt != "" {
+		str.WriteString("\n")
+		str.WriteString(e.Excerpt)
+	}
+	for i, entry := range e.StackTrace {
+		// deep recursion keeps its innermost and outermost calls
+		if skipped := len(e.StackTrace) - traceShown; skipped > 0 &&
+			i >= traceShown/2 && i < traceShown/2+skipped {
+			if i == traceShown/2 {
+				fmt.Fprintf(&str, "\n\t... %d more", skipped)
+			}
+			continue
+		}
+		str.WriteString("\n\t")
+		str.WriteString(entry.String())
+	}
+	return str.String()
+}
+
+func (e *Exception) Unwrap() error {
+	return e.Cause
+}
+
+// trace entries printed by Error
+const traceShown = 20
+
+// innermost trace entry with known script position
+func (e *Exception) location() (TraceEntry, bool) {
+	for _, entry := range e.StackTrace {
+		if !entry.Native && entry.Span.Start.Line > 0 {
+			return entry, true
+		}
 	}
-	return fmt.Sprintf(
-		"%s\n%s",
-		e.Message,
-		trace.String(),
-	)
+	return TraceEntry{}, false
+}
+
+// Value is what catch clause binds: thrown payload or exception itself
+func (e *Exception) Value() Value {
+	if e.Payload != nil {
+		return e.Payload
+	}
+	return e
 }
 
 type Array struct {
@@ -193,80 +329,240 @@ func (t *Table) Say() string {
 	return fmt.Sprintf("<table %p>", t)
 }
 
+type Module struct {
+	Path    string
+	Exports []string
+	env     *Env
+}
+
+func newModule(path string, env *Env) *Module {
+	return &Module{
+		Path:    path,
+		Exports: []string{},
+		env:     env,
+	}
+}
+
+func (m *Module) Type() ValueType { return VAL_MODULE }
+func (m *Module) Say() string {
+	return fmt.Sprintf("<module \"%s\">", m.Path)
+}
+
+// returns current value of exported name
+func (m *Module) Get(name string) (Value, error) {
+	if !slices.Contains(m.Exports, name) {
+		return nil, fmt.Errorf(
+			"module \"%s\" has no export '%s'",
+			m.Path,
+			name,
+		)
+	}
+	return m.env.Get(name)
+}
+
+// HashTable keeps pairs in insertion order, deleted entries are
+// compacted once they outnumber live ones. Keys are hashed by value for
+// booleans, numbers and strings, by identity for other values except
+// instances whose class defines hash and equals, those are bucketed by
+// result of hash and compared with equals
 type HashTable struct {
-	boolMap map[bool]Value
-	numMap  map[float64]Value
-	strMap  map[string]Value
+	index   map[hashKey]int
+	custom  map[hashKey][]int
+	entries []*HashEntry
+	deleted int
+}
+
+type HashEntry struct {
+	Key    Value
+	Value  Value
+	hash   hashKey
+	custom bool
+}
+
+type hashKey struct {
+	vType ValueType
+	value any
+}
+
+func toHashKey(key Value) (hashKey, error) {
+	switch key := key.(type) {
+	case *Null:
+		return hashKey{}, errors.New("unhashable type null")
+	case *Boolean:
+		return hashKey{VAL_BOOLEAN, key.Value}, nil
+	case *Number:
+		return hashKey{VAL_NUMBER, key.Value}, nil
+	case *String:
+		return hashKey{VAL_STRING, key.Value}, nil
+	default:
+		return hashKey{key.Type(), key}, nil
+	}
 }
 
+// keyer hashes and compares keys whose hash is defined by script,
+// evaluator is keyer, plainKeys hashes every instance by identity
+type keyer interface {
+	customHash(key Value) (hashKey, bool)
+	keysEqual(a, b Value) bool
+}
+
+type plainKeys struct{}
+
+func (plainKeys) customHash(Value) (hashKey, bool) { return hashKey{}, false }
+func (plainKeys) keysEqual(a, b Value) bool        { return a == b }
+
 func NewHashTable() *HashTable {
 	return &HashTable{
-		boolMap: map[bool]Value{},
-		numMap:  map[float64]Value{},
-		strMap:  map[string]Value{},
+		index:   map[hashKey]int{},
+		custom:  map[hashKey][]int{},
+		entries: []*HashEntry{},
 	}
 }
 
+// Get, Set and Delete never call script, instances are keys by identity
+
 func (ht *HashTable) Get(key Value) (Value, error) {
-	switch key := key.(type) {
-	case *Boolean:
-		if v, ok := ht.boolMap[key.Value]; ok {
-			return v, nil
+	value, ok, err := ht.lookup(plainKeys{}, key)
+	if err == nil && !ok {
+		err = errors.New("missing key")
+	}
+	return value, err
+}
+
+func (ht *HashTable) Delete(key Value) (bool, error) {
+	return ht.remove(plainKeys{}, key)
+}
+
+func (ht *HashTable) Set(key Value, value Value) (bool, error) {
+	return ht.put(plainKeys{}, key, value)
+}
+
+func (ht *HashTable) Size() int {
+	return len(ht.entries) - ht.deleted
+}
+
+// Clear removes all pairs
+func (ht *HashTable) Clear() {
+	*ht = *NewHashTable()
+}
+
+// Entries returns copy of pairs in insertion order
+func (ht *HashTable) Entries() []HashEntry {
+	entries := make([]HashEntry, 0, ht.Size())
+	for _, entry := range ht.entries {
+		if entry != nil {
+			entries = append(entries, *entry)
 		}
-		return nil, errors.New("missing key")
-	case *Number:
-		if v, ok := ht.numMap[key.Value]; ok {
-			return v, nil
+	}
+	return entries
+}
+
+// Copy returns table with same pairs in same order
+func (ht *HashTable) Copy() *HashTable {
+	c := NewHashTable()
+	for _, entry := range ht.entries {
+		if entry != nil {
+			copied := *entry
+			c.link(copied.hash, copied.custom, len(c.entries))
+			c.entries = append(c.entries, &copied)
 		}
-		return nil, errors.New("missing key")
-	case *String:
-		if v, ok := ht.strMap[key.Value]; ok {
-			return v, nil
+	}
+	return c
+}
+
+// hash of key and index of its entry, -1 when missing
+func (ht *HashTable) find(k keyer, key Value) (hashKey, bool, int, error) {
+	if hk, ok := k.customHash(key); ok {
+		// equals may change table, bucket is copied
+		for _, i := range slices.Clone(ht.custom[hk]) {
+			if i < len(ht.entries) && ht.entries[i] != nil &&
+				k.keysEqual(ht.entries[i].Key, key) {
+				return hk, true, i, nil
+			}
 		}
-		return nil, errors.New("missing key")
-	default:
-		return nil, errors.New("unhashable type")
+		return hk, true, -1, nil
+	}
+	hk, err := toHashKey(key)
+	if err != nil {
+		return hk, false, -1, err
 	}
+	if i, ok := ht.index[hk]; ok {
+		return hk, false, i, nil
+	}
+	return hk, false, -1, nil
 }
 
-func (ht *HashTable) Delete(key Value) (bool, error) {
-	switch key := key.(type) {
-	case *Boolean:
-		_, ok := ht.boolMap[key.Value]
-		delete(ht.boolMap, key.Value)
-		return ok, nil
-	case *Number:
-		_, ok := ht.numMap[key.Value]
-		delete(ht.numMap, key.Value)
-		return ok, nil
-	case *String:
-		_, ok := ht.strMap[key.Value]
-		delete(ht.strMap, key.Value)
-		return ok, nil
-	default:
-		return false, errors.New("unhashable type")
+func (ht *HashTable) lookup(k keyer, key Value) (Value, bool, error) {
+	_, _, i, err := ht.find(k, key)
+	if err != nil || i < 0 {
+		return nil, false, err
 	}
+	return ht.entries[i].Value, true, nil
 }
 
-func (ht *HashTable) Set(key Value, value Value) (bool, error) {
-	switch key := key.(type) {
-	case *Boolean:
-		_, ok := ht.boolMap[key.Value]
-		ht.boolMap[key.Value] = value
-		return ok, nil
-	case *Number:
-		_, ok := ht.numMap[key.Value]
-		ht.numMap[key.Value] = value
-		return ok, nil
-	case *String:
-		_, ok := ht.strMap[key.Value]
-		ht.strMap[key.Value] = value
-		return ok, nil
-	default:
-		return false, errors.New("unhashable type")
+// sets value of key, reports whether key existed
+func (ht *HashTable) put(k keyer, key Value, value Value) (bool, error) {
+	hk, custom, i, err := ht.find(k, key)
+	if err != nil {
+		return false, err
+	}
+	if i >= 0 {
+		ht.entries[i].Value = value
+		return true, nil
+	}
+	ht.link(hk, custom, len(ht.entries))
+	ht.entries = append(ht.entries, &HashEntry{
+		Key:    key,
+		Value:  value,
+		hash:   hk,
+		custom: custom,
+	})
+	return false, nil
+}
+
+// deletes key, reports whether it existed
+func (ht *HashTable) remove(k keyer, key Value) (bool, error) {
+	hk, custom, i, err := ht.find(k, key)
+	if err != nil || i < 0 {
+		return false, err
+	}
+	if custom {
+		bucket := slices.DeleteFunc(ht.custom[hk], func(j int) bool { return j == i })
+		if len(bucket) == 0 {
+			delete(ht.custom, hk)
+		} else {
+			ht.custom[hk] = bucket
+		}
+	} else {
+		delete(ht.index, hk)
+	}
+	ht.entries[i] = nil
+	ht.deleted++
+	if ht.deleted > ht.Size() {
+		ht.compact()
 	}
+	return true, nil
 }
 
-func (ht *HashTable) Size() int {
-	return len(ht.strMap) + len(ht.boolMap) + len(ht.numMap)
+// indexes entry i under its hash
+func (ht *HashTable) link(hk hashKey, custom bool, i int) {
+	if custom {
+		ht.custom[hk] = append(ht.custom[hk], i)
+	} else {
+		ht.index[hk] = i
+	}
+}
+
+func (ht *HashTable) compact() {
+	entries := make([]*HashEntry, 0, ht.Size())
+	clear(ht.custom)
+	for _, entry := range ht.entries {
+		if entry == nil {
+			continue
+		}
+		ht.link(entry.hash, entry.custom, len(entries))
+		entries = append(entries, entry)
+	}
+	ht.entries = entries
+	ht.deleted = 0
 }
@@ -0,0 +1,510 @@
+package evaluator
+
+import "slices"
+
+type handler struct {
+	address int
+	sp      int
+	env     *Env
+}
+
+type frame struct {
+	code      *Code
+	ip        int
+	base      int
+	env       *Env
+	this      Value
+	construct bool
+	traced    bool
+	handlers  []handler
+}
+
+type machine struct {
+	e      *Evaluator
+	stack  []Value
+	frames []*frame
+	scopes []*Env
+}
+
+func newMachine(e *Evaluator) *machine {
+	return &machine{
+		e:      e,
+		stack:  make([]Value, 0, 64),
+		frames: make([]*frame, 0, 8),
+	}
+}
+
+// runs script code in current env
+func (e *Evaluator) runCode(code *Code) Value {
+	m := newMachine(e)
+	f := &frame{
+		code:     code,
+		env:      e.env,
+		handlers: []handler{},
+	}
+	m.frames = append(m.frames, f)
+	if top, err := e.callStack.Peek(); err == nil {
+		top.vm = f
+	}
+	return m.run()
+}
+
+// runs compiled function, arguments must be checked by caller
+func (e *Evaluator) runFunction(fun *Function, this Value, args []Value) Value {
+	m := newMachine(e)
+	m.enter(fun, this, args, false)
+	return m.run()
+}
+
+func (m *machine) enter(
+	fun *Function,
+	this Value,
+	args []Value,
+	construct bool,
+) {
+	f := &frame{
+		code:      fun.Code,
+		base:      len(m.stack),
+		env:       m.e.env,
+		this:      this,
+		construct: construct,
+		traced:    true,
+		handlers:  []handler{},
+	}
+	m.e.pushFrame(&traceFrame{name: fun.Name, file: fun.File, vm: f})
+	m.frames = append(m.frames, f)
+	m.e.env = NewFrame(fun.Closure, fun.Slots)
+	m.e.env.SetThis(this, fun.Owner)
+	copy(m.e.env.slots, args)
+}
+
+// operand following opcode
+func (f *frame) operand() int {
+	v := readOperand(f.code.Instructions, f.ip)
+	f.ip += 2
+	return v
+}
+
+// block env, reusing one left by earlier block that no closure captured
+func (m *machine) scope(outer *Env, size int) *Env {
+	n := len(m.scopes)
+	if n == 0 || cap(m.scopes[n-1].slots) < size {
+		return NewFrame(outer, size)
+	}
+	env := m.scopes[n-1]
+	m.scopes = m.scopes[:n-1]
+	env.slots = env.slots[:size]
+	clear(env.slots)
+	env.outer, env.named, env.globals = outer, outer.named, outer.globals
+	return env
+}
+
+func (m *machine) leave() *frame {
+	f := m.frames[len(m.frames)-1]
+	m.frames = m.frames[:len(m.frames)-1]
+	m.e.env = f.env
+	if f.traced {
+		m.e.callStack.Pop()
+	}
+	return f
+}
+
+func (m *machine) run() Value {
+	for {
+		result, exc := m.protected()
+		if exc == nil {
+			return result
+		}
+		if exc.Fatal {
+			for len(m.frames) > 0 {
+				m.leave()
+			}
+			panic(exc)
+		}
+		if !m.unwind() {
+			panic(exc)
+		}
+		m.push(exc)
+	}
+}
+
+func (m *machine) protected() (result Value, exc *Exception) {
+	defer func() {
+		if r := recover(); r != nil {
+			if rExc, ok := r.(*Exception); ok {
+				exc = rExc
+				return
+			}
+			panic(r)
+		}
+	}()
+	return m.execute(), nil
+}
+
+// jumps to nearest try handler, leaving frames without one
+func (m *machine) unwind() bool {
+	for len(m.frames) > 0 {
+		f := m.frames[len(m.frames)-1]
+		if len(f.handlers) > 0 {
+			h := f.handlers[len(f.handlers)-1]
+			f.handlers = f.handlers[:len(f.handlers)-1]
+			m.stack = m.stack[:h.sp]
+			m.e.env = h.env
+			f.ip = h.address
+			return true
+		}
+		m.leave()
+	}
+	return false
+}
+
+func (m *machine) execute() Value {
+	e := m.e
+	f := m.frames[len(m.frames)-1]
+	code := f.code
+
+	// steps are counted per batch, remainder is counted on leaving
+	steps := 0
+	defer func() { e.steps += steps }()
+
+	for {
+		if steps++; steps == stepBatch {
+			e.stepMany(steps)
+			steps = 0
+		}
+		op := Opcode(code.Instructions[f.ip])
+		f.ip++
+
+		switch op {
+		case OP_CONSTANT:
+			// constants are immutable, every load shares one value
+			m.push(code.Constants[f.operand()])
+		case OP_NULL:
+			m.push(e.env.globals.Null)
+		case OP_TRUE:
+			m.push(e.env.globals.True)
+		case OP_FALSE:
+			m.push(e.env.globals.False)
+		case OP_POP:
+			m.pop()
+		case OP_DUP:
+			m.push(m.stack[len(m.stack)-1])
+		case OP_SWAP:
+			n := len(m.stack)
+			m.stack[n-1], m.stack[n-2] = m.stack[n-2], m.stack[n-1]
+
+		case OP_GET_NAME:
+			val, err := e.env.Get(code.Names[f.operand()])
+			if err != nil {
+				e.ThrowException("%s", err.Error())
+			}
+			m.push(val)
+		case OP_SET_NAME:
+			if err := e.env.Set(code.Names[f.operand()], m.pop()); err != nil {
+				e.ThrowException("%s", err.Error())
+			}
+		case OP_DECLARE:
+			if err := e.env.Declare(code.Names[f.operand()], m.pop()); err != nil {
+				e.ThrowException("%s", err.Error())
+			}
+		case OP_GET_LOCAL:
+			depth := f.operand()
+			val, err := e.env.GetLocal(depth, f.operand())
+			if err != nil {
+				e.ThrowException("%s", err.Error())
+			}
+			m.push(val)
+		case OP_SET_LOCAL:
+			depth := f.operand()
+			e.env.SetLocal(depth, f.operand(), m.pop())
+		case OP_THIS:
+			this := e.env.GetThis()
+			if this == nil {
+				e.ThrowException("'this' is undefined")
+			}
+			m.push(this)
+		case OP_SUPER:
+			m.push(e.super(code.Names[f.operand()]))
+		case OP_ENTER_SCOPE:
+			e.env = m.scope(e.env, f.operand())
+		case OP_EXIT_SCOPE:
+			scope := e.env
+			e.env = scope.outer
+			if !scope.captured {
+				m.scopes = append(m.scopes, scope)
+			}
+
+		case OP_BINARY:
+			op := codeOperators[f.operand()]
+			right := m.pop()
+			left := m.pop()
+			m.push(e.binary(op, left, right))
+		case OP_UNARY:
+			m.push(e.unary(codeOperators[f.operand()], m.pop()))
+
+		case OP_JUMP:
+			f.ip = f.operand()
+		case OP_JUMP_IF_FALSE:
+			address := f.operand()
+			if !toBoolean(m.pop()) {
+				f.ip = address
+			}
+		case OP_JUMP_IF_TRUE:
+			address := f.operand()
+			if toBoolean(m.pop()) {
+				f.ip = address
+			}
+		case OP_ITER:
+			m.push(e.iterator(m.pop()))
+		case OP_ITER_NEXT:
+			address := f.operand()
+			count := f.operand()
+			vars, ok := m.stack[len(m.stack)-1].(*Iterator).Next(count)
+			if !ok {
+				f.ip = address
+				continue
+			}
+			m.stack = append(m.stack, vars...)
+
+		case OP_CALL:
+			argc := f.operand()
+			calleePos := len(m.stack) - argc - 1
+			callee := m.stack[calleePos]
+			// callee copies args before anything is pushed over them
+			args := m.stack[calleePos+1:]
+			m.stack = m.stack[:calleePos]
+			if m.call(callee, args, nil) {
+				f = m.frames[len(m.frames)-1]
+				code = f.code
+			}
+		case OP_CALL_ARGS:
+			names := code.Constants[f.operand()].(*Array).Elements
+			var named []namedArg
+			if len(names) > 0 {
+				named = make([]namedArg, len(names))
+			}
+			for i := len(names) - 1; i >= 0; i-- {
+				named[i] = namedArg{names[i].(*String).Value, m.pop()}
+			}
+			args := m.pop().(*Array).Elements
+			if m.call(m.pop(), args, named) {
+				f = m.frames[len(m.frames)-1]
+				code = f.code
+			}
+		case OP_APPEND:
+			value := m.pop()
+			arr := m.stack[len(m.stack)-1].(*Array)
+			arr.Elements = append(arr.Elements, value)
+		case OP_SPREAD:
+			values := e.spread(m.pop())
+			arr := m.stack[len(m.stack)-1].(*Array)
+			arr.Elements = append(arr.Elements, values...)
+		case OP_DEFAULT:
+			slot := f.operand()
+			address := f.operand()
+			if e.env.slots[slot] != nil {
+				f.ip = address
+			}
+		case OP_GET_PROP:
+			m.push(e.getProperty(m.pop(), code.Names[f.operand()], false))
+		case OP_GET_THIS_PROP:
+			m.push(e.getProperty(m.pop(), code.Names[f.operand()], true))
+		case OP_SET_PROP:
+			name := code.Names[f.operand()]
+			obj := m.pop()
+			e.setProperty(obj, name, m.pop())
+		case OP_SET_THIS_PROP:
+			e.setThisProperty(code.Names[f.operand()], m.pop())
+		case OP_GET_INDEX:
+			index := m.pop()
+			m.push(e.getIndex(m.pop(), index))
+		case OP_SET_INDEX:
+			obj := m.pop()
+			index := m.pop()
+			e.setIndex(obj, index, m.pop())
+		case OP_SLICE:
+			end := m.pop()
+			start := m.pop()
+			m.push(e.getSlice(m.pop(), start, end))
+
+		case OP_CLOSURE:
+			fnCode := code.Functions[f.operand()]
+			e.env.capture()
+			m.push(&Function{
+				FType:      F_COMPILED,
+				Name:       fnCode.Name,
+				File:       e.file,
+				Parameters: fnCode.Parameters,
+				Required:   fnCode.Required,
+				Rest:       fnCode.Rest,
+				Code:       fnCode,
+				Closure:    e.env,
+				Slots:      fnCode.Slots,
+			})
+		case OP_CLASS:
+			m.push(m.class(code.Classes[f.operand()]))
+		case OP_ARRAY:
+			n := f.operand()
+			elems := slices.Clone(m.stack[len(m.stack)-n:])
+			m.stack = m.stack[:len(m.stack)-n]
+			e.alloc(sizeValue * n)
+			m.push(&Array{Elements: elems})
+		case OP_TABLE:
+			n := f.operand()
+			// hash methods of keys may run on stack
+			pairs := slices.Clone(m.stack[len(m.stack)-2*n:])
+			m.stack = m.stack[:len(m.stack)-2*n]
+			table := &Table{Pairs: NewHashTable()}
+			for i := 0; i < len(pairs); i += 2 {
+				e.tableSet(table, pairs[i], pairs[i+1])
+			}
+			m.push(table)
+		case OP_CONCAT:
+			n := f.operand()
+			str := e.concat(m.stack[len(m.stack)-n:])
+			m.stack = m.stack[:len(m.stack)-n]
+			m.push(str)
+
+		case OP_SAY:
+			e.sayValue(m.pop())
+		case OP_RETURN:
+			result := m.pop()
+			done := m.leave()
+			if done.construct {
+				result = done.this
+			}
+			m.stack = m.stack[:done.base]
+			if len(m.frames) == 0 {
+				return result
+			}
+			m.push(result)
+			f = m.frames[len(m.frames)-1]
+			code = f.code
+		case OP_THROW:
+			e.throwValue(m.pop())
+		case OP_RETHROW:
+			panic(m.pop().(*Exception))
+		case OP_SETUP_TRY:
+			f.handlers = append(f.handlers, handler{
+				address: f.operand(),
+				sp:      len(m.stack),
+				env:     e.env,
+			})
+		case OP_POP_TRY:
+			f.handlers = f.handlers[:len(f.handlers)-1]
+		case OP_MATCH_EXC:
+			class := e.catchClass(m.pop())
+			exc := m.stack[len(m.stack)-1].(*Exception)
+			if e.isInstance(exc.Value(), class) {
+				m.push(e.env.globals.True)
+			} else {
+				m.push(e.env.globals.False)
+			}
+		case OP_CAUGHT:
+			m.push(m.pop().(*Exception).Value())
+		case OP_ERROR:
+			e.ThrowException("%s", code.Constants[f.operand()].(*String).Value)
+
+		case OP_IMPORT:
+			e.import_(code.Imports[f.operand()])
+		case OP_EXPORT:
+			e.exportName(code.Names[f.operand()])
+		default:
+			e.ThrowException("unknown opcode %d", op)
+		}
+	}
+}
+
+// enters compiled function frame or calls other callee directly,
+// reports whether frame was entered
+func (m *machine) call(callee Value, args []Value, named []namedArg) bool {
+	var fun *Function
+	var this Value
+	construct := false
+	switch callee := callee.(type) {
+	case *Function:
+		fun = callee
+	case *Method:
+		fun, this, construct = callee.Function, callee.This, callee.IsConstructor
+	}
+	if fun != nil && fun.FType == F_NATIVE {
+		result := m.callNative(fun, this, args, named)
+		if construct {
+			result = this
+		}
+		m.push(result)
+		return false
+	}
+	if fun == nil || fun.FType != F_COMPILED {
+		m.push(m.e.callValue(callee, args, named...))
+		return false
+	}
+	m.enter(fun, this, m.e.bind(fun, args, named), construct)
+	return true
+}
+
+// calls native function directly, compiled code raises no control
+// signals so callFunction's handling of them is skipped
+func (m *machine) callNative(fun *Function, this Value, args []Value, named []namedArg) Value {
+	e := m.e
+	args = e.nativeArgs(fun, args, named)
+	e.pushFrame(&traceFrame{name: fun.Name, native: true})
+	defer e.callStack.Pop()
+	return fun.Native(e, this, args...)
+}
+
+func (m *machine) class(template *ClassTemplate) *Class {
+	count := len(template.Fields) + len(template.Constructors) +
+		len(template.Public) + len(template.Private) +
+		len(template.Getters) + len(template.Setters)
+	if template.Parent {
+		count++
+	}
+	values := m.stack[len(m.stack)-count:]
+	m.stack = m.stack[:len(m.stack)-count]
+
+	var parent Value
+	if template.Parent {
+		parent, values = values[0], values[1:]
+	}
+
+	take := func(names []string) map[string]*Function {
+		methods := map[string]*Function{}
+		for _, name := range names {
+			methods[name] = values[0].(*Function)
+			values = values[1:]
+		}
+		return methods
+	}
+	fields := map[string]Value{}
+	for _, name := range template.Fields {
+		fields[name] = values[0]
+		values = values[1:]
+	}
+	public := map[string]bool{}
+	for _, name := range template.PublicFields {
+		public[name] = true
+	}
+	class := &Class{
+		Name:         template.Name,
+		Fields:       fields,
+		PublicFields: public,
+		Constructors: take(template.Constructors),
+		Public:       take(template.Public),
+		Private:      take(template.Private),
+		Getters:      take(template.Getters),
+		Setters:      take(template.Setters),
+	}
+	m.e.inherit(class, parent)
+	return class
+}
+
+func (m *machine) push(value Value) {
+	m.stack = append(m.stack, value)
+}
+
+func (m *machine) pop() Value {
+	value := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return value
+}
@@ -7,11 +7,25 @@ import (
 
 type LexemeType string
 
+// EndLine and EndColumn point after last character of lexeme
 type Lexeme struct {
-	Type    LexemeType
-	Literal string
-	Line    int
-	Column  int
+	Type      LexemeType `json:"type"`
+	Literal   string     `json:"literal"`
+	Line      int        `json:"line"`
+	Column    int        `json:"column"`
+	EndLine   int        `json:"end_line"`
+	EndColumn int        `json:"end_column"`
+	// text and expression parts of TEMPLATE
+	Parts []TemplatePart `json:"parts,omitempty"`
+}
+
+// TemplatePart is decoded text of interpolated string or source of
+// expression inside ${}, Line and Column locate that source
+type TemplatePart struct {
+	Text   string `json:"text"`
+	Code   bool   `json:"code,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
 }
 
 func NewLexeme(type_ LexemeType, literal string, line, column int) *Lexeme {
@@ -41,10 +55,12 @@ const (
 	ERROR LexemeType = "__error"
 	EOF   LexemeType = "__eof"
 
-	PLUS  LexemeType = "+"
-	MINUS LexemeType = "-"
-	STAR  LexemeType = "*"
-	SLASH LexemeType = "/"
+	PLUS    LexemeType = "+"
+	MINUS   LexemeType = "-"
+	STAR    LexemeType = "*"
+	SLASH   LexemeType = "/"
+	PERCENT LexemeType = "%"
+	POWER   LexemeType = "**"
 
 	LT   LexemeType = "<"
 	LE   LexemeType = "<="
@@ -70,6 +86,7 @@ const (
 	COMMA     LexemeType = ","
 	ASSIGN    LexemeType = "="
 	DOT       LexemeType = "."
+	ELLIPSIS  LexemeType = "..."
 	WOW       LexemeType = "!"
 
 	OR  LexemeType = "or"
@@ -82,6 +99,7 @@ const (
 	BOOLEAN    LexemeType = "boolean"
 	NUMBER     LexemeType = "number"
 	STRING     LexemeType = "string"
+	TEMPLATE   LexemeType = "template"
 
 	FUN   LexemeType = "fun"
 	CLASS LexemeType = "class"
@@ -102,7 +120,8 @@ const (
 	CATCH   LexemeType = "catch"
 	FINALLY LexemeType = "finally"
 
-	THIS LexemeType = "this"
+	THIS  LexemeType = "this"
+	SUPER LexemeType = "super"
 
 	RETURN   LexemeType = "return"
 	BREAK    LexemeType = "break"
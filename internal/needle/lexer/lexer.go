@@ -1,7 +1,9 @@
 package lexer
 
 import (
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 const eof = 0x00
@@ -22,6 +24,14 @@ func New(source []rune) *Lexer {
 	}
 }
 
+// NewAt lexes source starting at line and column of enclosing source,
+// used for expressions interpolated into strings
+func NewAt(source []rune, line, column int) *Lexer {
+	lx := New(source)
+	lx.line, lx.column = line, column
+	return lx
+}
+
 func (lx *Lexer) Reset() {
 	lx.arrow = 0
 	lx.column = 1
@@ -29,6 +39,12 @@ func (lx *Lexer) Reset() {
 }
 
 func (lx *Lexer) NextLexeme() *Lexeme {
+	lexeme := lx.lexeme()
+	lexeme.EndLine, lexeme.EndColumn = lx.line, lx.column
+	return lexeme
+}
+
+func (lx *Lexer) lexeme() *Lexeme {
 	lx.skipWhite()
 	r := lx.read()
 
@@ -49,16 +65,20 @@ func (lx *Lexer) NextLexeme() *Lexeme {
 				return NewLexeme(NE, "!=", lx.line, lx.column-2)
 			}
 		}
+	} else if r == '.' && lx.peek() == '.' && lx.peekNext() == '.' {
+		lx.read()
+		lx.read()
+		return NewLexeme(ELLIPSIS, "...", lx.line, lx.column-3)
 	} else if r == '/' && lx.peek() == '/' {
 		lx.read()
 		lx.skipComment()
-		return lx.NextLexeme()
+		return lx.lexeme()
 	} else if r == '/' && lx.peek() == '*' {
 		lx.read()
 		if errLexeme := lx.skipMultilineComment(); errLexeme != nil {
 			return errLexeme
 		}
-		return lx.NextLexeme()
+		return lx.lexeme()
 	} else if t, ok := dual[string([]rune{r, lx.peek()})]; ok {
 		literal := string([]rune{r, lx.peek()})
 		lx.read()
@@ -69,6 +89,10 @@ func (lx *Lexer) NextLexeme() *Lexeme {
 		return lx.readIdentifier(r)
 	} else if isDigit(r) {
 		return lx.readNumber(r)
+	} else if r == '"' && lx.peek() == '"' && lx.peekNext() == '"' {
+		lx.read()
+		lx.read()
+		return lx.readRawString()
 	} else if r == '"' {
 		return lx.readString()
 	} else if r == '`' {
@@ -99,6 +123,18 @@ func (lx *Lexer) peek() rune {
 	return lx.source[lx.arrow]
 }
 
+func (lx *Lexer) peekNext() rune {
+	return lx.peekAt(1)
+}
+
+// rune offset runes after next one
+func (lx *Lexer) peekAt(offset int) rune {
+	if lx.arrow+offset >= len(lx.source) {
+		return eof
+	}
+	return lx.source[lx.arrow+offset]
+}
+
 func (lx *Lexer) skipWhite() {
 	for {
 		next := lx.peek()
@@ -177,51 +213,227 @@ func (lx *Lexer) readUniversalIdentifier() *Lexeme {
 	return NewLexeme(IDENTIFIER, str.String(), lx.line, column)
 }
 
+// digits of numbers with base prefix like 0x, 0b and 0o
+var numberBases = map[rune]func(rune) bool{
+	'x': isHexDigit,
+	'X': isHexDigit,
+	'b': isBinaryDigit,
+	'B': isBinaryDigit,
+	'o': isOctalDigit,
+	'O': isOctalDigit,
+}
+
+// reads decimal number with optional fraction and exponent or integer
+// with base prefix, digits may be separated by single underscores
 func (lx *Lexer) readNumber(firstChar rune) *Lexeme {
 	column := lx.column - 1
 	var str strings.Builder
 	str.WriteRune(firstChar)
+	isDigitOf, prefixed := numberBases[lx.peek()]
+	if firstChar == '0' && prefixed {
+		str.WriteRune(lx.read())
+		if !lx.readDigits(&str, isDigitOf, false) {
+			return NewLexeme(ERROR, str.String(), lx.line, column)
+		}
+		return NewLexeme(NUMBER, str.String(), lx.line, column)
+	}
+	ok := lx.readDigits(&str, isDigit, true)
+	if ok && lx.peek() == '.' && isDigit(lx.peekNext()) {
+		str.WriteRune(lx.read())
+		ok = lx.readDigits(&str, isDigit, false)
+	}
+	if ok && (lx.peek() == 'e' || lx.peek() == 'E') {
+		sign := lx.peekNext() == '+' || lx.peekNext() == '-'
+		if isDigit(lx.peekNext()) || sign && isDigit(lx.peekAt(2)) {
+			str.WriteRune(lx.read())
+			if sign {
+				str.WriteRune(lx.read())
+			}
+			ok = lx.readDigits(&str, isDigit, false)
+		}
+	}
+	if !ok {
+		return NewLexeme(ERROR, str.String(), lx.line, column)
+	}
+	return NewLexeme(NUMBER, str.String(), lx.line, column)
+}
 
+// reads digits and underscores between them, afterDigit tells that digit
+// was just read, reports whether any digit was read and no underscore is
+// misplaced
+func (lx *Lexer) readDigits(
+	str *strings.Builder,
+	isDigitOf func(rune) bool,
+	afterDigit bool,
+) bool {
 	for {
 		next := lx.peek()
-		if !isDigit(next) && next != '.' {
-			break
-		}
-		if next == '.' {
+		if next == '_' {
 			str.WriteRune(lx.read())
-			for {
-				next := lx.peek()
-				if !isDigit(next) {
-					break
-				}
-				str.WriteRune(lx.read())
+			if !afterDigit || !isDigitOf(lx.peek()) {
+				return false
 			}
-			break
+			afterDigit = false
+			continue
+		}
+		if !isDigitOf(next) {
+			return afterDigit
 		}
 		str.WriteRune(lx.read())
+		afterDigit = true
 	}
-	return NewLexeme(NUMBER, str.String(), lx.line, column)
 }
 
+// reads string after opening quote, escapes are decoded, string with
+// ${expression} parts becomes TEMPLATE lexeme whose literal is raw source
 func (lx *Lexer) readString() *Lexeme {
-	column := lx.column - 1
+	line, column := lx.line, lx.column-1
+	start := lx.arrow
 	var str strings.Builder
+	var parts []TemplatePart
 	for {
 		r := lx.read()
-		if esc, ok := escapes[string([]rune{r, lx.peek()})]; ok {
-			str.WriteRune(esc)
+		switch {
+		case r == '"':
+			if parts == nil {
+				return NewLexeme(STRING, str.String(), line, column)
+			}
+			parts = append(parts, TemplatePart{Text: str.String()})
+			lexeme := NewLexeme(TEMPLATE, string(lx.source[start:lx.arrow-1]), line, column)
+			lexeme.Parts = parts
+			return lexeme
+		case r == '\\':
+			if !lx.readEscape(&str) {
+				// rest of string is skipped so it is not lexed as code
+				lx.skipString()
+				return NewLexeme(ERROR, "\""+str.String(), line, column)
+			}
+		case r == '$' && lx.peek() == '{':
 			lx.read()
-			continue
+			parts = append(parts, TemplatePart{Text: str.String()})
+			str.Reset()
+			codeLine, codeColumn := lx.line, lx.column
+			code, ok := lx.readInterpolation()
+			if !ok {
+				return NewLexeme(ERROR, "${"+code, codeLine, codeColumn-2)
+			}
+			parts = append(parts, TemplatePart{
+				Text:   code,
+				Code:   true,
+				Line:   codeLine,
+				Column: codeColumn,
+			})
+		case r == '\n' || r == '\r' || r == eof:
+			return NewLexeme(ERROR, "\""+str.String(), line, column)
+		default:
+			str.WriteRune(r)
 		}
-		if r == '"' {
-			break
+	}
+}
+
+var escapes = map[rune]rune{
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+	'0':  0,
+	'"':  '"',
+	'\\': '\\',
+	'$':  '$',
+}
+
+// decodes escape after backslash, \u{...} is code point in hex
+func (lx *Lexer) readEscape(str *strings.Builder) bool {
+	r := lx.read()
+	if esc, ok := escapes[r]; ok {
+		str.WriteRune(esc)
+		return true
+	}
+	if r != 'u' || lx.read() != '{' {
+		return false
+	}
+	var code strings.Builder
+	for isHexDigit(lx.peek()) {
+		code.WriteRune(lx.read())
+	}
+	if lx.read() != '}' || code.Len() == 0 || code.Len() > 6 {
+		return false
+	}
+	point, _ := strconv.ParseInt(code.String(), 16, 32)
+	if !utf8.ValidRune(rune(point)) {
+		return false
+	}
+	str.WriteRune(rune(point))
+	return true
+}
+
+// reads source of ${} up to matching brace, strings nested in it may
+// hold braces and interpolations of their own
+func (lx *Lexer) readInterpolation() (string, bool) {
+	start := lx.arrow
+	depth := 0
+	for {
+		switch lx.read() {
+		case eof:
+			return string(lx.source[start:lx.arrow]), false
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return string(lx.source[start : lx.arrow-1]), true
+			}
+			depth--
+		case '"':
+			if !lx.skipString() {
+				return string(lx.source[start:lx.arrow]), false
+			}
 		}
-		if r == '\n' || r == '\r' || r == eof {
-			return NewLexeme(ERROR, "\""+str.String(), lx.line, column)
+	}
+}
+
+// skips rest of string, string inside interpolation
+func (lx *Lexer) skipString() bool {
+	for {
+		switch lx.read() {
+		case '"':
+			return true
+		case '\\':
+			lx.read()
+		case '$':
+			if lx.peek() == '{' {
+				lx.read()
+				if _, ok := lx.readInterpolation(); !ok {
+					return false
+				}
+			}
+		case '\n', '\r', eof:
+			return false
+		}
+	}
+}
+
+// reads triple-quoted string taken as is, without escapes and
+// interpolation, newline right after opening quotes is dropped
+func (lx *Lexer) readRawString() *Lexeme {
+	line, column := lx.line, lx.column-3
+	if lx.peek() == '\r' && lx.peekNext() == '\n' {
+		lx.read()
+	}
+	if lx.peek() == '\n' {
+		lx.read()
+	}
+	start := lx.arrow
+	for {
+		if lx.peek() == '"' && lx.peekNext() == '"' && lx.peekAt(2) == '"' {
+			literal := string(lx.source[start:lx.arrow])
+			lx.read()
+			lx.read()
+			lx.read()
+			return NewLexeme(STRING, literal, line, column)
+		}
+		if lx.read() == eof {
+			return NewLexeme(ERROR, `"""`, line, column)
 		}
-		str.WriteRune(r)
 	}
-	return NewLexeme(STRING, str.String(), lx.line, column)
 }
 
 // Include underscore
@@ -235,6 +447,20 @@ func isDigit(char rune) bool {
 	return '0' <= char && char <= '9'
 }
 
+func isHexDigit(char rune) bool {
+	return isDigit(char) ||
+		'a' <= char && char <= 'f' ||
+		'A' <= char && char <= 'F'
+}
+
+func isOctalDigit(char rune) bool {
+	return '0' <= char && char <= '7'
+}
+
+func isBinaryDigit(char rune) bool {
+	return char == '0' || char == '1'
+}
+
 var mono = map[rune]LexemeType{
 	'(': L_PAREN,
 	')': R_PAREN,
@@ -258,6 +484,7 @@ var mono = map[rune]LexemeType{
 	'-': MINUS,
 	'*': STAR,
 	'/': SLASH,
+	'%': PERCENT,
 }
 
 var dual = map[string]LexemeType{
@@ -265,6 +492,8 @@ var dual = map[string]LexemeType{
 	">=": GE,
 
 	"->": ARROW,
+
+	"**": POWER,
 }
 
 var indentifiers = map[string]LexemeType{
@@ -296,7 +525,8 @@ var indentifiers = map[string]LexemeType{
 	"catch":   CATCH,
 	"finally": FINALLY,
 
-	"this": THIS,
+	"this":  THIS,
+	"super": SUPER,
 
 	"return":   RETURN,
 	"break":    BREAK,
@@ -307,11 +537,3 @@ var indentifiers = map[string]LexemeType{
 
 	"say": SAY,
 }
-
-var escapes = map[string]rune{
-	"\n":   '\n',
-	"\r":   '\r',
-	"\t":   '\t',
-	"\"":   '"',
-	"\\\\": '\\',
-}
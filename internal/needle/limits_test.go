@@ -0,0 +1,85 @@
+package needle_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"needle/internal/needle"
+	"needle/internal/needle/evaluator"
+	"strings"
+	"testing"
+	"time"
+)
+
+const forever = `
+try {
+	while (true) {}
+} catch (e) {
+	say "caught";
+} finally {
+	say "finally";
+}
+`
+
+func TestLimits(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, n *needle.Needle) {
+		var out bytes.Buffer
+		n.SetOutput(&out)
+
+		n.SetLimits(evaluator.Limits{Steps: 10_000})
+		err := n.RunString(forever)
+		if !errors.Is(err, evaluator.ErrStepLimit) {
+			t.Errorf("expected step limit, got %v", err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("fatal exception caught: %q", out.String())
+		}
+
+		n.SetLimits(evaluator.Limits{})
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err = n.RunStringContext(ctx, forever)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected deadline, got %v", err)
+		}
+
+		n.SetLimits(evaluator.Limits{Memory: 1 << 16})
+		err = n.RunString(`var s = "x"; while (true) { s = s + s; }`)
+		if !errors.Is(err, evaluator.ErrMemoryLimit) {
+			t.Errorf("expected memory limit, got %v", err)
+		}
+
+		n.SetLimits(evaluator.Limits{CallDepth: 50})
+		out.Reset()
+		err = n.RunString(`
+var down = fun(n) { return down(n + 1); };
+try { down(0); } catch (e) { say e.message(); }
+down(0);
+`)
+		var exc *evaluator.Exception
+		if !errors.As(err, &exc) || !errors.Is(err, evaluator.ErrCallDepth) {
+			t.Errorf("expected call depth, got %v", err)
+		} else if exc.Fatal {
+			t.Errorf("call depth exception is fatal")
+		}
+		if out.String() != "\"call depth exceeded\"\n" {
+			t.Errorf("call depth not caught: %q", out.String())
+		}
+	})
+}
+
+func TestTableLiteralMemory(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, n *needle.Needle) {
+		var pairs []string
+		for i := range 20 {
+			pairs = append(pairs, fmt.Sprintf("[%d] = %d", i, i))
+		}
+		// 20 entries are charged once, 48 bytes each
+		n.SetLimits(evaluator.Limits{Memory: 1500})
+		err := n.RunString("var t = table{" + strings.Join(pairs, ", ") + "};")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package needle_test
+
+import (
+	"bytes"
+	"errors"
+	"needle/internal/needle"
+	"needle/internal/needle/evaluator"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPureProfile(t *testing.T) {
+	var out bytes.Buffer
+	n := newNeedle(&out)
+	if err := n.RunString(`say math.max(1, 2);`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, module := range []string{"io", "fs", "os", "time"} {
+		var syntaxErr *needle.SyntaxError
+		err := n.RunString(module + ".x;")
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%s: expected undefined name, got %v", module, err)
+		}
+	}
+}
+
+func TestModules(t *testing.T) {
+	n := needle.New()
+	if err := n.LoadModules(evaluator.MODULE_FS); err == nil {
+		t.Errorf("expected error for fs without root")
+	}
+	if err := n.LoadModules("net"); err == nil {
+		t.Errorf("expected error for unknown module")
+	}
+
+	var out bytes.Buffer
+	n.SetOutput(&out)
+	n.SetInput(strings.NewReader("first\nsecond"))
+	if err := n.LoadModules(evaluator.MODULE_IO); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := n.RunString(`
+io.print(io.read_line(), 1, null);
+io.write(io.read_line(), "!");
+io.print(io.read_line());
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "first 1 null\nsecond!null\n" {
+		t.Errorf("wrong output %q", out.String())
+	}
+}
+
+func TestFSRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0o755)
+	os.WriteFile(filepath.Join(dir, "secret"), []byte("x"), 0o644)
+
+	var out bytes.Buffer
+	n := newNeedle(&out)
+	if err := n.SetFSRoot(root); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := n.LoadModules(evaluator.MODULE_FS); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	n.SetGlobal("inside", &evaluator.String{Value: filepath.Join(root, "a", "b.txt")})
+	n.SetGlobal("outside", &evaluator.String{Value: filepath.Join(dir, "secret")})
+	err := n.RunString(`
+fs.mkdir("a");
+fs.write(inside, "data");
+say fs.read("a/b.txt");
+say fs.exists("a/../a/b.txt");
+for (path in array{"../secret", outside, "a/../../secret"}) {
+    try { fs.read(path); } catch (e) { say e.message(); }
+}
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `"data"
+true
+"path '../secret' is outside of fs root"
+"path '` + filepath.Join(dir, "secret") + `' is outside of fs root"
+"path 'a/../../secret' is outside of fs root"
+`
+	if out.String() != want {
+		t.Errorf("wrong output:\n%s", out.String())
+	}
+}
+
+func TestImportSandbox(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0o755)
+	os.WriteFile(filepath.Join(root, "lib.ndl"), []byte("export var x = 1;"), 0o644)
+	os.WriteFile(filepath.Join(dir, "secret.ndl"), []byte("secret contents"), 0o644)
+	os.Symlink(filepath.Join(dir, "secret.ndl"), filepath.Join(root, "link.ndl"))
+
+	var out bytes.Buffer
+	n := newNeedle(&out)
+	err := n.RunString(`import "/etc/passwd";`)
+	if err == nil || !strings.Contains(err.Error(), "imports need filesystem access") {
+		t.Fatalf("expected refused import, got %v", err)
+	}
+
+	if err := n.SetFSRoot(root); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := n.RunString(`import { x } from "` + filepath.Join(root, "lib") + `"; say x;`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, path := range []string{
+		filepath.Join(dir, "secret.ndl"),
+		filepath.Join(root, "..", "secret"),
+		filepath.Join(root, "link.ndl"),
+	} {
+		err := n.RunString(`import "` + path + `";`)
+		if err == nil || strings.Contains(err.Error(), "secret contents") {
+			t.Errorf("%s: expected refused import, got %v", path, err)
+		}
+	}
+	if out.String() != "1\n" {
+		t.Errorf("wrong output %q", out.String())
+	}
+}
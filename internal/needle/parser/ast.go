@@ -9,10 +9,12 @@ import (
 type Operator = string
 
 const (
-	OP_PLUS  Operator = "+"
-	OP_MINUS Operator = "-"
-	OP_STAR  Operator = "*"
-	OP_SLASH Operator = "/"
+	OP_PLUS    Operator = "+"
+	OP_MINUS   Operator = "-"
+	OP_STAR    Operator = "*"
+	OP_SLASH   Operator = "/"
+	OP_PERCENT Operator = "%"
+	OP_POWER   Operator = "**"
 
 	OP_EQ   Operator = "=="
 	OP_NE   Operator = "!="
@@ -30,9 +32,39 @@ const (
 	OP_NOT Operator = "!"
 )
 
+// Position is line and column of lexeme, both start from 1
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Span is source range of node, End is position after its last lexeme
+type Span struct {
+	Start Position
+	End   Position
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%s-%s", s.Start, s.End)
+}
+
+// Location is embedded by every node, zero for nodes made by parser
+// without source, like implicit null statements
+type Location struct {
+	Range Span
+}
+
+func (l *Location) Span() Span          { return l.Range }
+func (l *Location) location() *Location { return l }
+
 type Node interface {
 	fmt.Stringer
 	Node()
+	Span() Span
 }
 
 type Statement interface {
@@ -46,6 +78,9 @@ type Expression interface {
 }
 
 type Script struct {
+	Location
+	File       string
+	Source     string `json:"-"`
 	Statements []Statement
 }
 
@@ -61,14 +96,18 @@ func (s *Script) String() string {
 
 /* == statements =============================================================*/
 
-type BadStatement struct{}
+type BadStatement struct {
+	Location
+}
 
 func (bs *BadStatement) Node()          {}
 func (bs *BadStatement) Statement()     {}
 func (bs *BadStatement) String() string { return "__bad_statement" }
 
 type Block struct {
+	Location
 	Statements []Statement
+	Slots      int
 }
 
 func (b *Block) Node()      {}
@@ -85,6 +124,7 @@ func (b *Block) String() string {
 }
 
 type IfStatement struct {
+	Location
 	Condition Expression
 	Then      Statement
 	Else      Statement
@@ -102,6 +142,7 @@ func (is *IfStatement) String() string {
 }
 
 type WhileStatement struct {
+	Location
 	Condition Expression
 	Do        Statement
 }
@@ -116,7 +157,85 @@ func (ws *WhileStatement) String() string {
 	)
 }
 
+type ForStatement struct {
+	Location
+	Init      Statement
+	Condition Expression
+	Update    Statement
+	Do        Statement
+	Slots     int
+}
+
+func (fs *ForStatement) Node()      {}
+func (fs *ForStatement) Statement() {}
+func (fs *ForStatement) String() string {
+	return fmt.Sprintf(
+		"for (%s %s; %s) %s",
+		fs.Init,
+		fs.Condition,
+		strings.TrimSuffix(fs.Update.String(), ";"),
+		fs.Do,
+	)
+}
+
+type ForInStatement struct {
+	Location
+	Key      *IdentifierLiteral
+	Value    *IdentifierLiteral
+	Iterable Expression
+	Do       Statement
+	Slots    int
+}
+
+func (fs *ForInStatement) Node()      {}
+func (fs *ForInStatement) Statement() {}
+func (fs *ForInStatement) String() string {
+	vars := fs.Value.String()
+	if fs.Key != nil {
+		vars = fs.Key.String() + ", " + vars
+	}
+	return fmt.Sprintf(
+		"for (%s in %s) %s",
+		vars,
+		fs.Iterable,
+		fs.Do,
+	)
+}
+
+type SwitchStatement struct {
+	Location
+	Subject Expression
+	Cases   []*SwitchCase
+	Default *Block
+}
+
+func (ss *SwitchStatement) Node()      {}
+func (ss *SwitchStatement) Statement() {}
+func (ss *SwitchStatement) String() string {
+	var str strings.Builder
+	str.WriteString(fmt.Sprintf("switch (%s) {\n", ss.Subject))
+	for _, c := range ss.Cases {
+		str.WriteString(c.String())
+		str.WriteString("\n")
+	}
+	if ss.Default != nil {
+		str.WriteString(fmt.Sprintf("default: %s\n", ss.Default))
+	}
+	str.WriteString("}")
+	return str.String()
+}
+
+type SwitchCase struct {
+	Values []Expression
+	Body   *Block
+}
+
+func (sc *SwitchCase) String() string {
+	return fmt.Sprintf("case %s: %s", joinExpressions(sc.Values), sc.Body)
+}
+
 type DoStatement struct {
+	Location
 	Do    Statement
 	While Expression
 }
@@ -132,6 +251,7 @@ func (ds *DoStatement) String() string {
 }
 
 type ExpressionStatement struct {
+	Location
 	Expression Expression
 }
 
@@ -145,6 +265,7 @@ func (es *ExpressionStatement) String() string {
 }
 
 type AssignmentStatement struct {
+	Location
 	Left  Expression
 	Right Expression
 }
@@ -160,6 +281,7 @@ func (as *AssignmentStatement) String() string {
 }
 
 type Declaration struct {
+	Location
 	Identifier *IdentifierLiteral
 	Right      Expression
 }
@@ -175,6 +297,7 @@ func (d *Declaration) String() string {
 }
 
 type SayStatement struct {
+	Location
 	Expression Expression
 }
 
@@ -188,6 +311,7 @@ func (ss *SayStatement) String() string {
 }
 
 type ReturnStatement struct {
+	Location
 	Value Expression
 }
 
@@ -200,7 +324,9 @@ func (rs *ReturnStatement) String() string {
 	)
 }
 
-type BreakStatement struct{}
+type BreakStatement struct {
+	Location
+}
 
 func (bs *BreakStatement) Node()      {}
 func (bs *BreakStatement) Statement() {}
@@ -208,7 +334,9 @@ func (bs *BreakStatement) String() string {
 	return "break;"
 }
 
-type ContinueStatement struct{}
+type ContinueStatement struct {
+	Location
+}
 
 func (cs *ContinueStatement) Node()      {}
 func (cs *ContinueStatement) Statement() {}
@@ -217,25 +345,41 @@ func (cs *ContinueStatement) String() string {
 }
 
 type TryStatement struct {
+	Location
 	Try     Statement
-	Catch   Statement
-	As      *IdentifierLiteral
+	Catches []*CatchClause
 	Finally Statement
 }
 
 func (ts *TryStatement) Node()      {}
 func (ts *TryStatement) Statement() {}
 func (ts *TryStatement) String() string {
-	return fmt.Sprintf(
-		"try %s catch (%s) %s finally %s",
-		ts.Try,
-		ts.As,
-		ts.Catch,
-		ts.Finally,
-	)
+	var str strings.Builder
+	str.WriteString(fmt.Sprintf("try %s", ts.Try))
+	for _, c := range ts.Catches {
+		str.WriteString(" ")
+		str.WriteString(c.String())
+	}
+	str.WriteString(fmt.Sprintf(" finally %s", ts.Finally))
+	return str.String()
+}
+
+// CatchClause without type catches every thrown value
+type CatchClause struct {
+	As   *IdentifierLiteral
+	Type Expression
+	Body Statement
+}
+
+func (cc *CatchClause) String() string {
+	if cc.Type == nil {
+		return fmt.Sprintf("catch (%s) %s", cc.As, cc.Body)
+	}
+	return fmt.Sprintf("catch (%s: %s) %s", cc.As, cc.Type, cc.Body)
 }
 
 type ThrowStatement struct {
+	Location
 	Error Expression
 }
 
@@ -248,9 +392,87 @@ func (ts *ThrowStatement) String() string {
 	)
 }
 
+type ImportStatement struct {
+	Location
+	Path  *StringLiteral
+	Alias *IdentifierLiteral
+	Names []*ImportName
+}
+
+func (is *ImportStatement) Node()      {}
+func (is *ImportStatement) Statement() {}
+func (is *ImportStatement) String() string {
+	if is.Alias != nil {
+		return fmt.Sprintf(
+			"import %s as %s;",
+			is.Path,
+			is.Alias,
+		)
+	}
+	if is.Names != nil {
+		var names strings.Builder
+		for i, name := range is.Names {
+			names.WriteString(name.String())
+			if i != len(is.Names)-1 {
+				names.WriteString(", ")
+			}
+		}
+		return fmt.Sprintf(
+			"import {%s} from %s;",
+			names.String(),
+			is.Path,
+		)
+	}
+	return fmt.Sprintf(
+		"import %s;",
+		is.Path,
+	)
+}
+
+type ImportName struct {
+	Name  *IdentifierLiteral
+	Alias *IdentifierLiteral
+}
+
+func (in *ImportName) String() string {
+	if in.Alias.Value == in.Name.Value {
+		return in.Name.String()
+	}
+	return fmt.Sprintf("%s as %s", in.Name, in.Alias)
+}
+
+type ExportStatement struct {
+	Location
+	Declaration *Declaration
+	Names       []*IdentifierLiteral
+}
+
+func (es *ExportStatement) Node()      {}
+func (es *ExportStatement) Statement() {}
+func (es *ExportStatement) String() string {
+	if es.Declaration != nil {
+		return fmt.Sprintf(
+			"export %s",
+			es.Declaration,
+		)
+	}
+	var names strings.Builder
+	for i, name := range es.Names {
+		names.WriteString(name.String())
+		if i != len(es.Names)-1 {
+			names.WriteString(", ")
+		}
+	}
+	return fmt.Sprintf(
+		"export %s;",
+		names.String(),
+	)
+}
+
 /* == expression =============================================================*/
 
 type InfixExpression struct {
+	Location
 	Left     Expression
 	Right    Expression
 	Operator Operator
@@ -268,6 +490,7 @@ func (ie *InfixExpression) String() string {
 }
 
 type PrefixExpression struct {
+	Location
 	Right    Expression
 	Operator Operator
 }
@@ -283,6 +506,7 @@ func (pe *PrefixExpression) String() string {
 }
 
 type CallExpression struct {
+	Location
 	Left      Expression
 	Arguments []Expression
 }
@@ -304,7 +528,31 @@ func (ce *CallExpression) String() string {
 	)
 }
 
+type SpreadExpression struct {
+	Location
+	Value Expression
+}
+
+func (se *SpreadExpression) Node()       {}
+func (se *SpreadExpression) Expression() {}
+func (se *SpreadExpression) String() string {
+	return "..." + se.Value.String()
+}
+
+type NamedArgument struct {
+	Location
+	Name  *IdentifierLiteral
+	Value Expression
+}
+
+func (na *NamedArgument) Node()       {}
+func (na *NamedArgument) Expression() {}
+func (na *NamedArgument) String() string {
+	return fmt.Sprintf("%s = %s", na.Name, na.Value)
+}
+
 type PropertyExpression struct {
+	Location
 	Left     Expression
 	Property *IdentifierLiteral
 }
@@ -320,6 +568,7 @@ func (pe *PropertyExpression) String() string {
 }
 
 type IndexExpression struct {
+	Location
 	Left  Expression
 	Index Expression
 }
@@ -335,6 +584,7 @@ func (ie *IndexExpression) String() string {
 }
 
 type SliceExpression struct {
+	Location
 	Left  Expression
 	Start Expression
 	End   Expression
@@ -353,7 +603,9 @@ func (se *SliceExpression) String() string {
 
 /* == literals ===============================================================*/
 
-type NullLiteral struct{}
+type NullLiteral struct {
+	Location
+}
 
 func (nl *NullLiteral) Node()       {}
 func (nl *NullLiteral) Expression() {}
@@ -362,6 +614,7 @@ func (nl *NullLiteral) String() string {
 }
 
 type BooleanLiteral struct {
+	Location
 	Value bool
 }
 
@@ -375,6 +628,7 @@ func (bl *BooleanLiteral) String() string {
 }
 
 type NumberLiteral struct {
+	Location
 	Value float64
 }
 
@@ -385,6 +639,7 @@ func (nl *NumberLiteral) String() string {
 }
 
 type StringLiteral struct {
+	Location
 	Value string
 }
 
@@ -397,8 +652,36 @@ func (sl *StringLiteral) String() string {
 	)
 }
 
+// TemplateLiteral is interpolated string, Strings surround Values and
+// have one element more
+type TemplateLiteral struct {
+	Location
+	Strings []string
+	Values  []Expression
+}
+
+func (tl *TemplateLiteral) Node()       {}
+func (tl *TemplateLiteral) Expression() {}
+func (tl *TemplateLiteral) String() string {
+	var str strings.Builder
+	str.WriteString("\"")
+	for i, text := range tl.Strings {
+		str.WriteString(text)
+		if i < len(tl.Values) {
+			str.WriteString("${" + tl.Values[i].String() + "}")
+		}
+	}
+	str.WriteString("\"")
+	return str.String()
+}
+
 type IdentifierLiteral struct {
+	Location
 	Value string
+	// set by resolver, non local identifiers are looked up by name
+	Local bool
+	Depth int
+	Index int
 }
 
 func (il *IdentifierLiteral) Node()          {}
@@ -406,7 +689,11 @@ func (il *IdentifierLiteral) Expression()    {}
 func (il *IdentifierLiteral) String() string { return il.Value }
 
 type ClassLiteral struct {
+	Location
+	Name         string
+	Parent       Expression
 	Fields       []*Declaration
+	PublicFields map[string]bool
 	Constructors map[*IdentifierLiteral]*FunctionLiteral
 	Public       map[*IdentifierLiteral]*FunctionLiteral
 	Private      map[*IdentifierLiteral]*FunctionLiteral
@@ -420,7 +707,11 @@ func (cl *ClassLiteral) Node()       {}
 func (cl *ClassLiteral) Expression() {}
 func (cl *ClassLiteral) String() string {
 	var str strings.Builder
-	str.WriteString("class{")
+	str.WriteString("class")
+	if cl.Parent != nil {
+		str.WriteString(" extends " + cl.Parent.String() + " ")
+	}
+	str.WriteString("{")
 	for _, decl := range cl.Fields {
 		str.WriteString(decl.String() + " ")
 	}
@@ -444,30 +735,40 @@ func (cl *ClassLiteral) String() string {
 	return str.String()
 }
 
+// Defaults has entry per parameter, nil for parameters without default
 type FunctionLiteral struct {
+	Location
+	Name       string
 	Body       *Block
 	Parameters []*IdentifierLiteral
+	Defaults   []Expression
+	Rest       *IdentifierLiteral
+	Slots      int
 }
 
 func (fl *FunctionLiteral) Node()       {}
 func (fl *FunctionLiteral) Expression() {}
 func (fl *FunctionLiteral) String() string {
-	var str strings.Builder
+	params := []string{}
 	for i, param := range fl.Parameters {
-		str.WriteString(param.String())
-		if i != len(fl.Parameters)-1 {
-			str.WriteString(", ")
+		if fl.Defaults[i] != nil {
+			params = append(params, fmt.Sprintf("%s = %s", param, fl.Defaults[i]))
+		} else {
+			params = append(params, param.String())
 		}
 	}
-	params := str.String()
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
+	}
 	return fmt.Sprintf(
 		"fun(%s) %s",
-		params,
+		strings.Join(params, ", "),
 		fl.Body,
 	)
 }
 
 type ArrayLiteral struct {
+	Location
 	Elements []Expression
 }
 
@@ -486,8 +787,59 @@ func (al *ArrayLiteral) String() string {
 	return str.String()
 }
 
+type ConditionalExpression struct {
+	Location
+	Condition Expression
+	Then      Expression
+	Else      Expression
+}
+
+func (ce *ConditionalExpression) Node()       {}
+func (ce *ConditionalExpression) Expression() {}
+func (ce *ConditionalExpression) String() string {
+	return fmt.Sprintf(
+		"(%s ? %s : %s)",
+		ce.Condition,
+		ce.Then,
+		ce.Else,
+	)
+}
+
+type WhenExpression struct {
+	Location
+	Subject  Expression
+	Branches []*WhenBranch
+	Default  Expression
+}
+
+func (we *WhenExpression) Node()       {}
+func (we *WhenExpression) Expression() {}
+func (we *WhenExpression) String() string {
+	var str strings.Builder
+	str.WriteString(fmt.Sprintf("when (%s) { ", we.Subject))
+	for _, b := range we.Branches {
+		str.WriteString(b.String())
+		str.WriteString(" ")
+	}
+	if we.Default != nil {
+		str.WriteString(fmt.Sprintf("default -> %s; ", we.Default))
+	}
+	str.WriteString("}")
+	return str.String()
+}
+
+type WhenBranch struct {
+	Values []Expression
+	Result Expression
+}
+
+func (wb *WhenBranch) String() string {
+	return fmt.Sprintf("%s -> %s;", joinExpressions(wb.Values), wb.Result)
+}
+
 type TableLiteral struct {
-	Pairs map[Expression]Expression
+	Location
+	Pairs []*TablePair
 }
 
 func (tl *TableLiteral) Node()       {}
@@ -495,22 +847,47 @@ func (tl *TableLiteral) Expression() {}
 func (tl *TableLiteral) String() string {
 	var str strings.Builder
 	str.WriteString("table{")
-	i := 0
-	for k, v := range tl.Pairs {
-		str.WriteString(
-			fmt.Sprintf("[%s] = %s", k, v),
-		)
+	for i, pair := range tl.Pairs {
+		str.WriteString(pair.String())
 		if i != len(tl.Pairs)-1 {
 			str.WriteString(", ")
 		}
-		i++
 	}
 	str.WriteString("}")
 	return str.String()
 }
 
-type ThisLiteral struct{}
+type TablePair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (tp *TablePair) String() string {
+	return fmt.Sprintf("[%s] = %s", tp.Key, tp.Value)
+}
+
+// member of parent class of method's class bound to this
+type SuperExpression struct {
+	Location
+	Property *IdentifierLiteral
+}
+
+func (se *SuperExpression) Node()          {}
+func (se *SuperExpression) Expression()    {}
+func (se *SuperExpression) String() string { return "super." + se.Property.Value }
+
+type ThisLiteral struct {
+	Location
+}
 
 func (tl *ThisLiteral) Node()          {}
 func (tl *ThisLiteral) Expression()    {}
 func (tl *ThisLiteral) String() string { return "this" }
+
+func joinExpressions(exprs []Expression) string {
+	strs := make([]string, len(exprs))
+	for i, expr := range exprs {
+		strs[i] = expr.String()
+	}
+	return strings.Join(strs, ", ")
+}
@@ -1,21 +1,68 @@
 package parser
 
 import (
-	"errors"
 	"fmt"
 	"needle/internal/needle/lexer"
+	"strconv"
+	"strings"
 )
 
+// Error is syntax error at lexeme, AtEOF reports that input ended before
+// construct was complete, so more input could fix it
+type Error struct {
+	Message  string
+	Position Position
+	AtEOF    bool
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf(
+		"%s at line %d, column %d",
+		e.Message,
+		e.Position.Line,
+		e.Position.Column,
+	)
+}
+
 type parseError struct {
 	Error error
 }
 
 func panicParseError(lexeme *lexer.Lexeme, message string, a ...any) {
-	finalMessage := fmt.Sprintf(
-		"%s at line %d, column %d",
-		fmt.Sprintf(message, a...),
-		lexeme.Line,
-		lexeme.Column,
-	)
-	panic(&parseError{Error: errors.New(finalMessage)})
+	panic(&parseError{Error: &Error{
+		Message:  fmt.Sprintf(message, a...),
+		Position: Position{Line: lexeme.Line, Column: lexeme.Column},
+		AtEOF:    lexeme.Type == lexer.EOF,
+	}})
+}
+
+// Excerpt returns source line where span starts with span underlined by
+// carets, span continuing on next lines is underlined to end of line
+func Excerpt(source string, span Span) string {
+	lines := strings.Split(source, "\n")
+	if span.Start.Line < 1 || span.Start.Line > len(lines) {
+		return ""
+	}
+	line := []rune(strings.TrimRight(lines[span.Start.Line-1], "\r"))
+	start := min(span.Start.Column-1, len(line))
+	end := span.End.Column - 1
+	if span.End.Line != span.Start.Line || end > len(line) {
+		end = len(line)
+	}
+	end = max(end, start+1)
+
+	number := strconv.Itoa(span.Start.Line)
+	gutter := strings.Repeat(" ", len(number))
+	var str strings.Builder
+	fmt.Fprintf(&str, " %s | %s\n", number, string(line))
+	fmt.Fprintf(&str, " %s | ", gutter)
+	for _, r := range line[:start] {
+		if r == '\t' {
+			str.WriteRune('\t')
+		} else {
+			str.WriteRune(' ')
+		}
+	}
+	str.WriteString(strings.Repeat("^", end-start))
+	return str.String()
 }
@@ -3,6 +3,7 @@ package parser
 import (
 	"needle/internal/needle/lexer"
 	"strconv"
+	"strings"
 )
 
 type Lexemer interface {
@@ -12,7 +13,8 @@ type Lexemer interface {
 type Parser struct {
 	lexemer  Lexemer
 	current  *lexer.Lexeme
-	backpack *lexer.Lexeme
+	backpack []*lexer.Lexeme
+	noLambda bool // set while parsing when values
 	errors   []error
 }
 
@@ -32,18 +34,35 @@ func (p *Parser) Parse() (*Script, []error) {
 	}
 
 	for !p.check(lexer.EOF) {
-		stmt := p.catch(p.declaration)
+		stmt := p.catch(p.topLevel)
 		if stmt == nil {
 			p.synchronize()
 			stmt = newBadStatement()
 		}
 		script.Statements = append(script.Statements, stmt)
-		p.advance()
+		p.skip()
 	}
+	script.Range = Span{End: p.end()}
+	script.Range.Start = Position{Line: 1, Column: 1}
 
 	return script, p.errors
 }
 
+func (p *Parser) topLevel() Statement {
+	start := p.position()
+	var stmt Statement
+	switch p.current.Type {
+	case lexer.IMPORT:
+		stmt = p.importStmt()
+	case lexer.EXPORT:
+		stmt = p.exportStmt()
+	default:
+		return p.declaration()
+	}
+	p.finish(stmt, start)
+	return stmt
+}
+
 func (p *Parser) declaration() Statement {
 	switch p.current.Type {
 	case lexer.VAR:
@@ -54,6 +73,14 @@ func (p *Parser) declaration() Statement {
 }
 
 func (p *Parser) statement() Statement {
+	start := p.position()
+	stmt := p.bareStatement()
+	p.finish(stmt, start)
+	return stmt
+}
+
+// statement without span
+func (p *Parser) bareStatement() Statement {
 	switch p.current.Type {
 	case lexer.SEMICOLON:
 		return newNullStatement()
@@ -61,8 +88,12 @@ func (p *Parser) statement() Statement {
 		return p.block()
 	case lexer.WHILE:
 		return p.whileStmt()
+	case lexer.FOR:
+		return p.forStmt()
 	case lexer.DO:
 		return p.doStmt()
+	case lexer.SWITCH:
+		return p.switchStmt()
 	case lexer.IF:
 		return p.ifStmt()
 	case lexer.SAY:
@@ -81,20 +112,22 @@ func (p *Parser) statement() Statement {
 		return &ContinueStatement{}
 	}
 
-	expr := p.expression(LOWEST)
-	if p.peek().Type == lexer.ASSIGN {
-		p.advance()
-		return p.assignStmt(expr)
-	}
-
-	p.expect(lexer.SEMICOLON)
-	return &ExpressionStatement{Expression: expr}
+	return p.simpleStmt(lexer.SEMICOLON)
 }
 
 func (p *Parser) expression(prec precedence) Expression {
 	var expr Expression
+	start := p.position()
+	lambda := !p.noLambda
+	p.noLambda = false
 	switch p.current.Type {
 	case lexer.L_PAREN:
+		if lambda && p.lambdaAhead() {
+			lit := &FunctionLiteral{}
+			p.parameters(lit)
+			expr = p.lambdaLit(lit)
+			break
+		}
 		p.advance()
 		if p.check(lexer.R_PAREN) {
 			panicParseError(
@@ -113,6 +146,8 @@ func (p *Parser) expression(prec precedence) Expression {
 		expr = p.arrayLit()
 	case lexer.TABLE:
 		expr = p.tableLit()
+	case lexer.WHEN:
+		expr = p.whenExpr()
 
 	case lexer.NULL:
 		expr = &NullLiteral{}
@@ -123,18 +158,26 @@ func (p *Parser) expression(prec precedence) Expression {
 			expr = &BooleanLiteral{Value: val}
 		}
 	case lexer.NUMBER:
-		if val, err := strconv.ParseFloat(p.current.Literal, 64); err != nil {
-			panic(err)
-		} else {
-			expr = &NumberLiteral{Value: val}
-		}
+		expr = &NumberLiteral{Value: p.number()}
 	case lexer.STRING:
 		expr = &StringLiteral{Value: p.current.Literal}
+	case lexer.TEMPLATE:
+		expr = p.templateLit()
 
 	case lexer.IDENTIFIER:
-		expr = &IdentifierLiteral{Value: p.current.Literal}
+		expr = p.identifier()
+		if lambda && p.peek().Type == lexer.ARROW {
+			expr = p.lambdaLit(&FunctionLiteral{
+				Parameters: []*IdentifierLiteral{expr.(*IdentifierLiteral)},
+				Defaults:   []Expression{nil},
+			})
+		}
 	case lexer.THIS:
 		expr = &ThisLiteral{}
+	case lexer.SUPER:
+		p.expect(lexer.DOT)
+		p.expect(lexer.IDENTIFIER)
+		expr = &SuperExpression{Property: p.identifier()}
 
 	case lexer.MINUS, lexer.PLUS, lexer.WOW:
 		op := p.current.Literal
@@ -148,14 +191,18 @@ func (p *Parser) expression(prec precedence) Expression {
 			p.current.Literal,
 		)
 	}
+	p.finish(expr, start)
 
 	for prec < p.peekPrecedence() {
 		p.advance()
 		switch p.current.Type {
 		case lexer.PLUS, lexer.MINUS, lexer.STAR, lexer.SLASH,
+			lexer.PERCENT, lexer.POWER,
 			lexer.LT, lexer.LE, lexer.GT, lexer.GE, lexer.EQ, lexer.NE,
 			lexer.AND, lexer.OR, lexer.IS, lexer.ISNT:
 			expr = p.infixExpr(expr)
+		case lexer.QUESTION:
+			expr = p.conditionalExpr(expr)
 		case lexer.L_PAREN:
 			expr = p.callExpr(expr)
 		case lexer.DOT:
@@ -169,6 +216,7 @@ func (p *Parser) expression(prec precedence) Expression {
 				p.current.Literal,
 			)
 		}
+		p.finish(expr, start)
 	}
 
 	return expr
@@ -178,18 +226,22 @@ func (p *Parser) expression(prec precedence) Expression {
 
 func (p *Parser) varDecl() *Declaration {
 	stmt := &Declaration{}
+	start := p.position()
 
 	p.expect(lexer.IDENTIFIER)
-	stmt.Identifier = &IdentifierLiteral{Value: p.current.Literal}
+	stmt.Identifier = p.identifier()
 
 	p.advance()
 	if p.check(lexer.SEMICOLON) {
 		stmt.Right = newNullExpression()
+		p.finish(stmt, start)
 		return stmt
 	} else if p.check(lexer.ASSIGN) {
 		p.advance()
 		stmt.Right = p.expression(LOWEST)
+		nameLiteral(stmt.Right, stmt.Identifier.Value)
 		p.expect(lexer.SEMICOLON)
+		p.finish(stmt, start)
 		return stmt
 	}
 	panicParseError(
@@ -199,12 +251,82 @@ func (p *Parser) varDecl() *Declaration {
 	return nil
 }
 
+/* == modules ================================================================*/
+
+func (p *Parser) importStmt() *ImportStatement {
+	stmt := &ImportStatement{}
+	p.advance()
+	if p.check(lexer.L_BRACE) {
+		stmt.Names = p.importNames()
+		p.advance()
+		if !p.checkLiteral(LIT_FROM) {
+			panicParseError(
+				p.current,
+				"expected '%s'",
+				LIT_FROM,
+			)
+		}
+		p.advance()
+	}
+	if !p.check(lexer.STRING) {
+		panicParseError(
+			p.current,
+			"expected module path",
+		)
+	}
+	stmt.Path = &StringLiteral{Value: p.current.Literal}
+	p.finish(stmt.Path, p.position())
+	if stmt.Names == nil && p.peek().Type == lexer.IDENTIFIER &&
+		p.peek().Literal == LIT_AS {
+		p.advance()
+		p.expect(lexer.IDENTIFIER)
+		stmt.Alias = p.identifier()
+	}
+	p.expect(lexer.SEMICOLON)
+	return stmt
+}
+
+func (p *Parser) exportStmt() *ExportStatement {
+	stmt := &ExportStatement{}
+	p.advance()
+	if p.check(lexer.VAR) {
+		stmt.Declaration = p.varDecl()
+		return stmt
+	}
+	stmt.Names = []*IdentifierLiteral{}
+	for {
+		if !p.check(lexer.IDENTIFIER) {
+			panicParseError(
+				p.current,
+				"expected 'identifier' or 'var'",
+			)
+		}
+		stmt.Names = append(
+			stmt.Names,
+			p.identifier(),
+		)
+		p.advance()
+		if p.check(lexer.SEMICOLON) {
+			break
+		}
+		if !p.check(lexer.COMMA) {
+			panicParseError(
+				p.current,
+				"expected ',' or ';'",
+			)
+		}
+		p.advance()
+	}
+	return stmt
+}
+
 /* == stmt ===================================================================*/
 
 func (p *Parser) block() *Block {
 	block := &Block{
 		Statements: make([]Statement, 0),
 	}
+	start := p.position()
 
 	p.advance()
 	for !p.check(lexer.R_BRACE) {
@@ -222,6 +344,7 @@ func (p *Parser) block() *Block {
 			)
 		}
 	}
+	p.finish(block, start)
 
 	return block
 }
@@ -237,6 +360,179 @@ func (p *Parser) whileStmt() *WhileStatement {
 	return stmt
 }
 
+func (p *Parser) forStmt() Statement {
+	p.expect(lexer.L_PAREN)
+	p.advance()
+	if p.check(lexer.IDENTIFIER) {
+		next := p.peek()
+		if next.Type == lexer.COMMA ||
+			next.Type == lexer.IDENTIFIER && next.Literal == LIT_IN {
+			return p.forInStmt()
+		}
+	}
+
+	stmt := &ForStatement{}
+	switch p.current.Type {
+	case lexer.SEMICOLON:
+		stmt.Init = newNullStatement()
+	case lexer.VAR:
+		stmt.Init = p.varDecl()
+	default:
+		stmt.Init = p.simpleStmt(lexer.SEMICOLON)
+	}
+	p.advance()
+	if p.check(lexer.SEMICOLON) {
+		stmt.Condition = &BooleanLiteral{Value: true}
+	} else {
+		stmt.Condition = p.expression(LOWEST)
+		p.expect(lexer.SEMICOLON)
+	}
+	p.advance()
+	if p.check(lexer.R_PAREN) {
+		stmt.Update = newNullStatement()
+	} else {
+		stmt.Update = p.simpleStmt(lexer.R_PAREN)
+	}
+	p.advance()
+	stmt.Do = p.statement()
+	return stmt
+}
+
+func (p *Parser) forInStmt() *ForInStatement {
+	stmt := &ForInStatement{}
+	stmt.Value = p.identifier()
+	p.advance()
+	if p.check(lexer.COMMA) {
+		p.expect(lexer.IDENTIFIER)
+		stmt.Key = stmt.Value
+		stmt.Value = p.identifier()
+		p.advance()
+	}
+	if !p.checkLiteral(LIT_IN) {
+		panicParseError(
+			p.current,
+			"expected '%s'",
+			LIT_IN,
+		)
+	}
+	p.advance()
+	stmt.Iterable = p.expression(LOWEST)
+	p.expect(lexer.R_PAREN)
+	p.advance()
+	stmt.Do = p.statement()
+	return stmt
+}
+
+func (p *Parser) switchStmt() *SwitchStatement {
+	stmt := &SwitchStatement{Cases: []*SwitchCase{}}
+	stmt.Subject = p.subject()
+	p.expect(lexer.L_BRACE)
+	p.advance()
+	for !p.check(lexer.R_BRACE) {
+		switch p.current.Type {
+		case lexer.CASE:
+			c := &SwitchCase{Values: p.caseValues(lexer.COLON)}
+			c.Body = p.caseBody()
+			stmt.Cases = append(stmt.Cases, c)
+		case lexer.DEFAULT:
+			if stmt.Default != nil {
+				panicParseError(p.current, "duplicate 'default'")
+			}
+			p.expect(lexer.COLON)
+			stmt.Default = p.caseBody()
+		default:
+			panicParseError(p.current, "expected 'case' or 'default'")
+		}
+	}
+	return stmt
+}
+
+// parenthesized switch or when subject
+func (p *Parser) subject() Expression {
+	p.expect(lexer.L_PAREN)
+	p.advance()
+	subject := p.expression(LOWEST)
+	p.expect(lexer.R_PAREN)
+	return subject
+}
+
+// comma separated values up to end lexeme, starts before first value
+func (p *Parser) caseValues(end lexer.LexemeType) []Expression {
+	values := []Expression{}
+	for {
+		p.advance()
+		// arrow after when value ends it instead of starting lambda
+		p.noLambda = end == lexer.ARROW
+		values = append(values, p.expression(LOWEST))
+		p.advance()
+		if p.check(end) {
+			return values
+		}
+		if !p.check(lexer.COMMA) {
+			panicParseError(
+				p.current,
+				"expected ',' or '%s'",
+				end,
+			)
+		}
+	}
+}
+
+// statements up to next case, default or end of switch
+func (p *Parser) caseBody() *Block {
+	block := &Block{
+		Statements: make([]Statement, 0),
+	}
+	start := p.position()
+
+	p.advance()
+	for !p.check(lexer.CASE) &&
+		!p.check(lexer.DEFAULT) &&
+		!p.check(lexer.R_BRACE) {
+		if p.check(lexer.EOF) {
+			panicParseError(
+				p.current,
+				"expected '}'",
+			)
+		}
+		stmt := p.catch(p.declaration)
+		if stmt == nil {
+			p.synchronize()
+			stmt = newBadStatement()
+		}
+		block.Statements = append(block.Statements, stmt)
+		p.advance()
+	}
+	p.finish(block, start)
+
+	return block
+}
+
+func (p *Parser) whenExpr() *WhenExpression {
+	expr := &WhenExpression{Branches: []*WhenBranch{}}
+	expr.Subject = p.subject()
+	p.expect(lexer.L_BRACE)
+	for p.peek().Type != lexer.R_BRACE {
+		if p.peek().Type == lexer.DEFAULT {
+			p.advance()
+			if expr.Default != nil {
+				panicParseError(p.current, "duplicate 'default'")
+			}
+			p.expect(lexer.ARROW)
+			p.advance()
+			expr.Default = p.expression(LOWEST)
+		} else {
+			branch := &WhenBranch{Values: p.caseValues(lexer.ARROW)}
+			p.advance()
+			branch.Result = p.expression(LOWEST)
+			expr.Branches = append(expr.Branches, branch)
+		}
+		p.expect(lexer.SEMICOLON)
+	}
+	p.advance()
+	return expr
+}
+
 func (p *Parser) doStmt() *DoStatement {
 	stmt := &DoStatement{}
 	p.advance()
@@ -277,36 +573,42 @@ func (p *Parser) sayStmt() *SayStatement {
 }
 
 func (p *Parser) tryStmt() *TryStatement {
-	stmt := &TryStatement{}
-	ended := false
+	stmt := &TryStatement{Catches: []*CatchClause{}}
 	p.advance()
 	stmt.Try = p.statement()
-	if p.peek().Type == lexer.CATCH {
+	for p.peek().Type == lexer.CATCH {
 		p.advance()
+		if n := len(stmt.Catches); n > 0 && stmt.Catches[n-1].Type == nil {
+			panicParseError(
+				p.current,
+				"catch after untyped catch",
+			)
+		}
+		clause := &CatchClause{}
 		p.expect(lexer.L_PAREN)
 		p.expect(lexer.IDENTIFIER)
-		stmt.As = &IdentifierLiteral{Value: p.current.Literal}
+		clause.As = p.identifier()
+		if p.peek().Type == lexer.COLON {
+			p.advance()
+			p.advance()
+			clause.Type = p.expression(LOWEST)
+		}
 		p.expect(lexer.R_PAREN)
 		p.advance()
-		stmt.Catch = p.statement()
-		ended = true
-	} else {
-		stmt.As = &IdentifierLiteral{Value: "_"}
-		stmt.Catch = newNullStatement()
+		clause.Body = p.statement()
+		stmt.Catches = append(stmt.Catches, clause)
 	}
 	if p.peek().Type == lexer.FINALLY {
 		p.advance()
 		p.advance()
 		stmt.Finally = p.statement()
-		ended = true
-	} else {
-		stmt.Finally = newNullStatement()
-	}
-	if !ended {
+	} else if len(stmt.Catches) == 0 {
 		panicParseError(
 			p.current,
 			"expected 'catch' or 'finally'",
 		)
+	} else {
+		stmt.Finally = newNullStatement()
 	}
 	return stmt
 }
@@ -331,12 +633,19 @@ func (p *Parser) returnStmt() *ReturnStatement {
 	return stmt
 }
 
-func (p *Parser) assignStmt(left Expression) *AssignmentStatement {
-	stmt := &AssignmentStatement{Left: left}
-	p.advance()
-	stmt.Right = p.expression(LOWEST)
-	p.expect(lexer.SEMICOLON)
-	return stmt
+// expression or assignment statement closed by end lexeme
+func (p *Parser) simpleStmt(end lexer.LexemeType) Statement {
+	expr := p.expression(LOWEST)
+	if p.peek().Type == lexer.ASSIGN {
+		p.advance()
+		stmt := &AssignmentStatement{Left: expr}
+		p.advance()
+		stmt.Right = p.expression(LOWEST)
+		p.expect(end)
+		return stmt
+	}
+	p.expect(end)
+	return &ExpressionStatement{Expression: expr}
 }
 
 /* == expr ===================================================================*/
@@ -344,12 +653,18 @@ func (p *Parser) assignStmt(left Expression) *AssignmentStatement {
 func (p *Parser) classLit() *ClassLiteral {
 	lit := &ClassLiteral{
 		Fields:       []*Declaration{},
+		PublicFields: map[string]bool{},
 		Constructors: map[*IdentifierLiteral]*FunctionLiteral{},
 		Public:       map[*IdentifierLiteral]*FunctionLiteral{},
 		Private:      map[*IdentifierLiteral]*FunctionLiteral{},
 		Getters:      map[*IdentifierLiteral]*FunctionLiteral{},
 		Setters:      map[*IdentifierLiteral]*FunctionLiteral{},
 	}
+	if next := p.peek(); next.Type == lexer.IDENTIFIER && next.Literal == LIT_EXTENDS {
+		p.advance()
+		p.advance()
+		lit.Parent = p.expression(LOWEST)
+	}
 	p.expect(lexer.L_BRACE)
 	p.advance()
 	for !p.check(lexer.R_BRACE) {
@@ -358,24 +673,29 @@ func (p *Parser) classLit() *ClassLiteral {
 			lit.Fields = append(lit.Fields, decl)
 		} else if p.current.Literal == LIT_CONSTRUCTOR {
 			p.expect(lexer.IDENTIFIER)
-			name := &IdentifierLiteral{Value: p.current.Literal}
-			lit.Constructors[name] = p.funLit()
+			name := p.identifier()
+			lit.Constructors[name] = p.method(name)
+		} else if p.current.Literal == LIT_PUBLIC && p.peek().Type == lexer.VAR {
+			p.advance()
+			decl := p.varDecl()
+			lit.Fields = append(lit.Fields, decl)
+			lit.PublicFields[decl.Identifier.Value] = true
 		} else if p.current.Literal == LIT_PUBLIC {
 			p.expect(lexer.IDENTIFIER)
-			name := &IdentifierLiteral{Value: p.current.Literal}
-			lit.Public[name] = p.funLit()
+			name := p.identifier()
+			lit.Public[name] = p.method(name)
 		} else if p.current.Literal == LIT_PRIVATE {
 			p.expect(lexer.IDENTIFIER)
-			name := &IdentifierLiteral{Value: p.current.Literal}
-			lit.Private[name] = p.funLit()
+			name := p.identifier()
+			lit.Private[name] = p.method(name)
 		} else if p.current.Literal == LIT_GET {
 			p.expect(lexer.IDENTIFIER)
-			name := &IdentifierLiteral{Value: p.current.Literal}
-			lit.Getters[name] = p.funLit()
+			name := p.identifier()
+			lit.Getters[name] = p.method(name)
 		} else if p.current.Literal == LIT_SET {
 			p.expect(lexer.IDENTIFIER)
-			name := &IdentifierLiteral{Value: p.current.Literal}
-			lit.Setters[name] = p.funLit()
+			name := p.identifier()
+			lit.Setters[name] = p.method(name)
 		} else {
 			panicParseError(
 				p.current,
@@ -393,12 +713,36 @@ func (p *Parser) classLit() *ClassLiteral {
 	return lit
 }
 
+func (p *Parser) method(name *IdentifierLiteral) *FunctionLiteral {
+	lit := p.funLit()
+	lit.Name = name.Value
+	return lit
+}
+
 func (p *Parser) funLit() *FunctionLiteral {
 	lit := &FunctionLiteral{}
+	start := p.position()
 	p.expect(lexer.L_PAREN)
-	lit.Parameters = p.parameters()
+	p.parameters(lit)
 	p.expect(lexer.L_BRACE)
 	lit.Body = p.block()
+	p.finish(lit, start)
+	return lit
+}
+
+// arrow lambda, expression body returns its value
+func (p *Parser) lambdaLit(lit *FunctionLiteral) *FunctionLiteral {
+	p.expect(lexer.ARROW)
+	p.advance()
+	if p.check(lexer.L_BRACE) {
+		lit.Body = p.block()
+		return lit
+	}
+	value := p.expression(LOWEST)
+	ret := &ReturnStatement{Value: value}
+	ret.Range = value.Span()
+	lit.Body = &Block{Statements: []Statement{ret}}
+	lit.Body.Range = value.Span()
 	return lit
 }
 
@@ -422,11 +766,26 @@ func (p *Parser) infixExpr(left Expression) *InfixExpression {
 		Operator: p.current.Literal,
 	}
 	prec := p.currentPrecedence()
+	if prec == POWER {
+		// right associative, 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		prec--
+	}
 	p.advance()
 	expr.Right = p.expression(prec)
 	return expr
 }
 
+// else branch is parsed at lowest precedence to nest to the right
+func (p *Parser) conditionalExpr(cond Expression) *ConditionalExpression {
+	expr := &ConditionalExpression{Condition: cond}
+	p.advance()
+	expr.Then = p.expression(LOWEST)
+	p.expect(lexer.COLON)
+	p.advance()
+	expr.Else = p.expression(LOWEST)
+	return expr
+}
+
 func (p *Parser) callExpr(left Expression) *CallExpression {
 	expr := &CallExpression{Left: left}
 	expr.Arguments = p.arguments()
@@ -436,7 +795,7 @@ func (p *Parser) callExpr(left Expression) *CallExpression {
 func (p *Parser) propExpr(left Expression) *PropertyExpression {
 	expr := &PropertyExpression{Left: left}
 	p.expect(lexer.IDENTIFIER)
-	expr.Property = &IdentifierLiteral{Value: p.current.Literal}
+	expr.Property = p.identifier()
 	return expr
 }
 
@@ -459,10 +818,72 @@ func (p *Parser) indexOrSliceExpr(left Expression) Expression {
 	return &SliceExpression{Left: left, Start: index, End: end}
 }
 
+// parses expressions of ${} parts each with own parser positioned at
+// part source
+func (p *Parser) templateLit() *TemplateLiteral {
+	lit := &TemplateLiteral{}
+	for _, part := range p.current.Parts {
+		if !part.Code {
+			lit.Strings = append(lit.Strings, part.Text)
+			continue
+		}
+		lit.Values = append(lit.Values, p.interpolation(part))
+	}
+	return lit
+}
+
+func (p *Parser) interpolation(part lexer.TemplatePart) Expression {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		// end of interpolated source is not end of input
+		if pErr, ok := r.(*parseError); ok {
+			if err := pErr.Error.(*Error); err.AtEOF {
+				err.Message = "unexpected end of interpolation"
+				err.AtEOF = false
+			}
+		}
+		panic(r)
+	}()
+	sub := New(lexer.NewAt([]rune(part.Text), part.Line, part.Column))
+	if sub.check(lexer.EOF) {
+		panicParseError(p.current, "empty interpolation")
+	}
+	expr := sub.expression(LOWEST)
+	sub.advance()
+	if !sub.check(lexer.EOF) {
+		panicParseError(sub.current, "unexpected '%s' in interpolation", sub.current.Literal)
+	}
+	return expr
+}
+
 /* == parse utility ==========================================================*/
 
-func (p *Parser) tablePairs() map[Expression]Expression {
-	pairs := map[Expression]Expression{}
+// value of number literal, literals with base prefix are integers
+func (p *Parser) number() float64 {
+	literal := p.current.Literal
+	if len(literal) > 1 && literal[0] == '0' && isBasePrefix(literal[1]) {
+		val, err := strconv.ParseUint(literal, 0, 64)
+		if err != nil {
+			panicParseError(p.current, "number '%s' out of range", literal)
+		}
+		return float64(val)
+	}
+	val, err := strconv.ParseFloat(strings.ReplaceAll(literal, "_", ""), 64)
+	if err != nil {
+		panicParseError(p.current, "number '%s' out of range", literal)
+	}
+	return val
+}
+
+func isBasePrefix(char byte) bool {
+	return strings.IndexByte("xXbBoO", char) >= 0
+}
+
+func (p *Parser) tablePairs() []*TablePair {
+	pairs := []*TablePair{}
 	if p.peek().Type == lexer.R_BRACE {
 		p.advance()
 		return pairs
@@ -475,7 +896,7 @@ func (p *Parser) tablePairs() map[Expression]Expression {
 		p.expect(lexer.ASSIGN)
 		p.advance()
 		v := p.expression(LOWEST)
-		pairs[k] = v
+		pairs = append(pairs, &TablePair{Key: k, Value: v})
 		p.advance()
 		if p.check(lexer.R_BRACE) {
 			break
@@ -521,15 +942,39 @@ func (p *Parser) arrayElements() []Expression {
 	return elems
 }
 
+// named arguments follow positional and spread ones
 func (p *Parser) arguments() []Expression {
 	args := []Expression{}
+	named := false
 	p.advance()
 	if p.check(lexer.R_PAREN) {
 		return args
 	}
 	for {
-		expr := p.expression(LOWEST)
-		args = append(args, expr)
+		var arg Expression
+		switch {
+		case p.check(lexer.ELLIPSIS):
+			start := p.position()
+			p.advance()
+			arg = &SpreadExpression{Value: p.expression(LOWEST)}
+			p.finish(arg, start)
+		case p.check(lexer.IDENTIFIER) && p.peek().Type == lexer.ASSIGN:
+			name := p.identifier()
+			p.advance()
+			p.advance()
+			arg = &NamedArgument{Name: name, Value: p.expression(LOWEST)}
+			p.finish(arg, name.Range.Start)
+			named = true
+		default:
+			arg = p.expression(LOWEST)
+		}
+		if _, ok := arg.(*NamedArgument); named && !ok {
+			panicParseError(
+				p.current,
+				"positional argument after named argument",
+			)
+		}
+		args = append(args, arg)
 		p.advance()
 		if p.check(lexer.R_PAREN) {
 			break
@@ -548,12 +993,9 @@ func (p *Parser) arguments() []Expression {
 	return args
 }
 
-func (p *Parser) parameters() []*IdentifierLiteral {
-	params := []*IdentifierLiteral{}
+func (p *Parser) importNames() []*ImportName {
+	names := []*ImportName{}
 	p.advance()
-	if p.check(lexer.R_PAREN) {
-		return params
-	}
 	for {
 		if !p.check(lexer.IDENTIFIER) {
 			panicParseError(
@@ -561,30 +1003,107 @@ func (p *Parser) parameters() []*IdentifierLiteral {
 				"expected 'identifier'",
 			)
 		}
-		params = append(
-			params,
-			&IdentifierLiteral{Value: p.current.Literal},
-		)
+		name := &ImportName{
+			Name: p.identifier(),
+		}
+		name.Alias = name.Name
 		p.advance()
-		if p.check(lexer.R_PAREN) {
+		if p.checkLiteral(LIT_AS) {
+			p.expect(lexer.IDENTIFIER)
+			name.Alias = p.identifier()
+			p.advance()
+		}
+		names = append(names, name)
+		if p.check(lexer.R_BRACE) {
 			break
 		}
 		if !p.check(lexer.COMMA) {
 			panicParseError(
 				p.current,
-				"expected ',' or ')'",
+				"expected ',' or '}'",
 			)
 		}
 		p.advance()
+		if p.check(lexer.R_BRACE) {
+			break
+		}
+	}
+	return names
+}
+
+// parameters with defaults follow required ones, rest parameter is last
+func (p *Parser) parameters(lit *FunctionLiteral) {
+	lit.Parameters = []*IdentifierLiteral{}
+	lit.Defaults = []Expression{}
+	p.advance()
+	for !p.check(lexer.R_PAREN) {
+		if p.check(lexer.ELLIPSIS) {
+			p.expect(lexer.IDENTIFIER)
+			lit.Rest = p.identifier()
+			p.expect(lexer.R_PAREN)
+			return
+		}
+		if !p.check(lexer.IDENTIFIER) {
+			panicParseError(
+				p.current,
+				"expected 'identifier'",
+			)
+		}
+		param := p.identifier()
+		var def Expression
+		if p.peek().Type == lexer.ASSIGN {
+			p.advance()
+			p.advance()
+			def = p.expression(LOWEST)
+		} else if len(lit.Defaults) > 0 && lit.Defaults[len(lit.Defaults)-1] != nil {
+			panicParseError(
+				p.current,
+				"parameter without default after default",
+			)
+		}
+		lit.Parameters = append(lit.Parameters, param)
+		lit.Defaults = append(lit.Defaults, def)
+		p.advance()
 		if p.check(lexer.R_PAREN) {
 			break
 		}
+		if !p.check(lexer.COMMA) {
+			panicParseError(
+				p.current,
+				"expected ',' or ')'",
+			)
+		}
+		p.advance()
 	}
-	return params
 }
 
 /* == utility =============================================================== */
 
+// start of current lexeme
+func (p *Parser) position() Position {
+	return Position{Line: p.current.Line, Column: p.current.Column}
+}
+
+// end of current lexeme
+func (p *Parser) end() Position {
+	return Position{Line: p.current.EndLine, Column: p.current.EndColumn}
+}
+
+// finish spans node from start to current lexeme unless it has span
+func (p *Parser) finish(node Node, start Position) {
+	if loc, ok := node.(interface{ location() *Location }); ok {
+		if l := loc.location(); l.Range.Start.Line == 0 {
+			l.Range = Span{Start: start, End: p.end()}
+		}
+	}
+}
+
+func (p *Parser) identifier() *IdentifierLiteral {
+	ident := &IdentifierLiteral{Value: p.current.Literal}
+	ident.Range = Span{Start: p.position(), End: p.end()}
+	return ident
+}
+
 func (p *Parser) currentPrecedence() precedence {
 	return precedences[p.current.Type]
 }
@@ -612,16 +1131,37 @@ func (p *Parser) synchronize() {
 		if p.check(lexer.SEMICOLON) || p.check(lexer.R_BRACE) {
 			return
 		}
-		switch p.peek().Type {
-		case lexer.L_BRACE, lexer.VAR, lexer.WHILE, lexer.DO,
+		var next *lexer.Lexeme
+		for !p.tolerate(func() { next = p.peek() }) {
+		}
+		switch next.Type {
+		case lexer.L_BRACE, lexer.VAR, lexer.WHILE, lexer.FOR, lexer.DO,
+			lexer.SWITCH, lexer.CASE, lexer.DEFAULT,
 			lexer.SAY, lexer.IF, lexer.RETURN,
-			lexer.BREAK, lexer.CONTINUE, lexer.TRY:
+			lexer.BREAK, lexer.CONTINUE, lexer.TRY,
+			lexer.IMPORT, lexer.EXPORT:
 			return
 		}
-		p.advance()
+		p.skip()
 	}
 }
 
+// advances, recording and skipping wrong lexemes
+func (p *Parser) skip() {
+	for !p.tolerate(p.advance) {
+	}
+}
+
+// runs f recording parse error instead of panicking, reports success
+func (p *Parser) tolerate(f func()) (ok bool) {
+	p.catch(func() Statement {
+		f()
+		ok = true
+		return nil
+	})
+	return ok
+}
+
 // checks next token and stands on it
 func (p *Parser) expect(type_ lexer.LexemeType) {
 	p.advance()
@@ -644,21 +1184,51 @@ func (p *Parser) check(t lexer.LexemeType) bool {
 	return p.current.Type == t
 }
 
+// checks current token is identifier with given literal
+func (p *Parser) checkLiteral(literal string) bool {
+	return p.current.Type == lexer.IDENTIFIER && p.current.Literal == literal
+}
+
 func (p *Parser) peek() *lexer.Lexeme {
-	temp := p.current
-	p.advance()
-	lxm := p.current
-	p.current = temp
-	p.backpack = lxm
-	return lxm
+	return p.peekAt(1)
+}
+
+// returns n-th lexeme after current
+func (p *Parser) peekAt(n int) *lexer.Lexeme {
+	for len(p.backpack) < n {
+		p.backpack = append(p.backpack, p.next())
+	}
+	return p.backpack[n-1]
+}
+
+// reports whether parenthesis at current lexeme opens lambda parameters
+func (p *Parser) lambdaAhead() bool {
+	depth := 1
+	for i := 1; ; i++ {
+		switch p.peekAt(i).Type {
+		case lexer.L_PAREN:
+			depth++
+		case lexer.R_PAREN:
+			depth--
+			if depth == 0 {
+				return p.peekAt(i+1).Type == lexer.ARROW
+			}
+		case lexer.EOF:
+			return false
+		}
+	}
 }
 
 func (p *Parser) advance() {
-	if p.backpack != nil {
-		p.current = p.backpack
-		p.backpack = nil
+	if len(p.backpack) > 0 {
+		p.current = p.backpack[0]
+		p.backpack = p.backpack[1:]
 		return
 	}
+	p.current = p.next()
+}
+
+func (p *Parser) next() *lexer.Lexeme {
 	next := p.lexemer.NextLexeme()
 	if next.Type == lexer.ERROR {
 		panicParseError(
@@ -666,7 +1236,7 @@ func (p *Parser) advance() {
 			"wrong lexeme",
 		)
 	}
-	p.current = next
+	return next
 }
 
 const (
@@ -675,25 +1245,33 @@ const (
 	LIT_SET         = "set"
 	LIT_PRIVATE     = "private"
 	LIT_PUBLIC      = "public"
+	LIT_EXTENDS     = "extends"
 	LIT_INFIX       = "infix"
+	LIT_FROM        = "from"
+	LIT_AS          = "as"
+	LIT_IN          = "in"
 )
 
 type precedence uint8
 
 const (
-	LOWEST precedence = iota
-	OR                // or
-	AND               // and
-	EQ                // == !=
-	COMP              // < <= > >=
-	TERM              // + -
-	FACTOR            // * /
-	UN                // - + !
-	CALL              // . () []
+	LOWEST  precedence = iota
+	TERNARY            // ? :
+	OR                 // or
+	AND                // and
+	EQ                 // == !=
+	COMP               // < <= > >=
+	TERM               // + -
+	FACTOR             // * / %
+	UN                 // - + !
+	POWER              // **
+	CALL               // . () []
 	HIGHEST
 )
 
 var precedences = map[lexer.LexemeType]precedence{
+	lexer.QUESTION: TERNARY,
+
 	lexer.OR: OR,
 
 	lexer.AND: AND,
@@ -711,14 +1289,44 @@ var precedences = map[lexer.LexemeType]precedence{
 	lexer.PLUS:  TERM,
 	lexer.MINUS: TERM,
 
-	lexer.STAR:  FACTOR,
-	lexer.SLASH: FACTOR,
+	lexer.STAR:    FACTOR,
+	lexer.SLASH:   FACTOR,
+	lexer.PERCENT: FACTOR,
+
+	lexer.POWER: POWER,
 
 	lexer.L_PAREN:   CALL,
 	lexer.L_BRACKET: CALL,
 	lexer.DOT:       CALL,
 }
 
+// names anonymous function or class after declared variable,
+// class methods are prefixed with class name
+func nameLiteral(expr Expression, name string) {
+	switch lit := expr.(type) {
+	case *FunctionLiteral:
+		if lit.Name == "" {
+			lit.Name = name
+		}
+	case *ClassLiteral:
+		if lit.Name != "" {
+			return
+		}
+		lit.Name = name
+		for _, methods := range []map[*IdentifierLiteral]*FunctionLiteral{
+			lit.Constructors,
+			lit.Public,
+			lit.Private,
+			lit.Getters,
+			lit.Setters,
+		} {
+			for _, method := range methods {
+				method.Name = name + "." + method.Name
+			}
+		}
+	}
+}
+
 func newNullStatement() *ExpressionStatement {
 	return &ExpressionStatement{
 		Expression: &NullLiteral{},
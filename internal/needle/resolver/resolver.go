@@ -0,0 +1,366 @@
+package resolver
+
+import (
+	"fmt"
+	"needle/internal/needle/parser"
+)
+
+// local scope, declarations are prescanned to give forward
+// references from nested functions a slot
+type scope struct {
+	declared map[string]int
+	pending  map[string]int
+	size     int
+	function bool
+}
+
+func newScope(function bool) *scope {
+	return &scope{
+		declared: map[string]int{},
+		pending:  map[string]int{},
+		size:     0,
+		function: function,
+	}
+}
+
+type Resolver struct {
+	known      func(name string) bool
+	scopes     []*scope
+	globals    map[string]bool
+	topLevel   map[string]bool
+	functions  int
+	starImport bool
+	errors     []error
+}
+
+// known reports names already defined outside of script (builtins, host
+// globals, previous REPL inputs), can be nil
+func New(known func(name string) bool) *Resolver {
+	if known == nil {
+		known = func(string) bool { return false }
+	}
+	return &Resolver{
+		known:    known,
+		scopes:   []*scope{},
+		globals:  map[string]bool{},
+		topLevel: map[string]bool{},
+		errors:   nil,
+	}
+}
+
+// Resolve binds local identifiers of script to (depth, index) slots
+func (r *Resolver) Resolve(script *parser.Script) []error {
+	r.prescanTopLevel(script.Statements)
+	for _, stmt := range script.Statements {
+		r.statement(stmt)
+	}
+	return r.errors
+}
+
+func (r *Resolver) statement(node parser.Statement) {
+	switch node := node.(type) {
+	case *parser.Block:
+		s := r.push(false)
+		r.prescan(node.Statements)
+		r.statements(node.Statements)
+		node.Slots = s.size
+		r.pop()
+	case *parser.Declaration:
+		r.expression(node.Right)
+		r.declare(node.Identifier)
+	case *parser.SayStatement:
+		r.expression(node.Expression)
+	case *parser.IfStatement:
+		r.expression(node.Condition)
+		r.statement(node.Then)
+		r.statement(node.Else)
+	case *parser.WhileStatement:
+		r.expression(node.Condition)
+		r.statement(node.Do)
+	case *parser.ForStatement:
+		s := r.push(false)
+		r.statement(node.Init)
+		r.expression(node.Condition)
+		r.statement(node.Update)
+		r.statement(node.Do)
+		node.Slots = s.size
+		r.pop()
+	case *parser.ForInStatement:
+		r.expression(node.Iterable)
+		s := r.push(false)
+		if node.Key != nil {
+			r.declare(node.Key)
+		}
+		r.declare(node.Value)
+		r.statement(node.Do)
+		node.Slots = s.size
+		r.pop()
+	case *parser.SwitchStatement:
+		r.expression(node.Subject)
+		for _, c := range node.Cases {
+			r.expressions(c.Values)
+			r.statement(c.Body)
+		}
+		if node.Default != nil {
+			r.statement(node.Default)
+		}
+	case *parser.DoStatement:
+		r.statement(node.Do)
+		r.expression(node.While)
+	case *parser.ExpressionStatement:
+		r.expression(node.Expression)
+	case *parser.AssignmentStatement:
+		r.expression(node.Right)
+		r.expression(node.Left)
+	case *parser.ReturnStatement:
+		r.expression(node.Value)
+	case *parser.TryStatement:
+		r.statement(node.Try)
+		for _, clause := range node.Catches {
+			r.expression(clause.Type)
+			r.push(false)
+			r.declare(clause.As)
+			r.statement(clause.Body)
+			r.pop()
+		}
+		r.statement(node.Finally)
+	case *parser.ThrowStatement:
+		r.expression(node.Error)
+	case *parser.ImportStatement:
+		if node.Alias != nil {
+			r.declare(node.Alias)
+		}
+		for _, name := range node.Names {
+			r.declare(name.Alias)
+		}
+	case *parser.ExportStatement:
+		if node.Declaration != nil {
+			r.statement(node.Declaration)
+		}
+		for _, name := range node.Names {
+			if !r.globals[name.Value] {
+				r.error(name, "'%s' used before declaration", name.Value)
+			}
+		}
+	}
+}
+
+func (r *Resolver) statements(stmts []parser.Statement) {
+	for _, stmt := range stmts {
+		r.statement(stmt)
+	}
+}
+
+func (r *Resolver) expression(node parser.Expression) {
+	switch node := node.(type) {
+	case *parser.InfixExpression:
+		r.expression(node.Left)
+		r.expression(node.Right)
+	case *parser.PrefixExpression:
+		r.expression(node.Right)
+	case *parser.CallExpression:
+		r.expression(node.Left)
+		r.expressions(node.Arguments)
+	case *parser.PropertyExpression:
+		r.expression(node.Left)
+	case *parser.IndexExpression:
+		r.expression(node.Left)
+		r.expression(node.Index)
+	case *parser.SliceExpression:
+		r.expression(node.Left)
+		r.expression(node.Start)
+		r.expression(node.End)
+	case *parser.IdentifierLiteral:
+		r.reference(node)
+	case *parser.FunctionLiteral:
+		r.function(node)
+	case *parser.ClassLiteral:
+		r.expression(node.Parent)
+		for _, decl := range node.Fields {
+			r.expression(decl.Right)
+		}
+		for _, methods := range []map[*parser.IdentifierLiteral]*parser.FunctionLiteral{
+			node.Constructors,
+			node.Public,
+			node.Private,
+			node.Getters,
+			node.Setters,
+		} {
+			for _, lit := range methods {
+				r.function(lit)
+			}
+		}
+	case *parser.SpreadExpression:
+		r.expression(node.Value)
+	case *parser.NamedArgument:
+		r.expression(node.Value)
+	case *parser.ConditionalExpression:
+		r.expression(node.Condition)
+		r.expression(node.Then)
+		r.expression(node.Else)
+	case *parser.WhenExpression:
+		r.expression(node.Subject)
+		for _, b := range node.Branches {
+			r.expressions(b.Values)
+			r.expression(b.Result)
+		}
+		r.expression(node.Default)
+	case *parser.ArrayLiteral:
+		r.expressions(node.Elements)
+	case *parser.TemplateLiteral:
+		r.expressions(node.Values)
+	case *parser.TableLiteral:
+		for _, pair := range node.Pairs {
+			r.expression(pair.Key)
+			r.expression(pair.Value)
+		}
+	}
+}
+
+func (r *Resolver) expressions(exprs []parser.Expression) {
+	for _, expr := range exprs {
+		r.expression(expr)
+	}
+}
+
+func (r *Resolver) function(node *parser.FunctionLiteral) {
+	s := r.push(true)
+	r.functions++
+	for i, param := range node.Parameters {
+		r.expression(node.Defaults[i])
+		r.declare(param)
+	}
+	if node.Rest != nil {
+		r.declare(node.Rest)
+	}
+	r.prescan(node.Body.Statements)
+	r.statements(node.Body.Statements)
+	node.Slots = s.size
+	r.functions--
+	r.pop()
+}
+
+/* == bindings ===============================================================*/
+
+func (r *Resolver) declare(ident *parser.IdentifierLiteral) {
+	name := ident.Value
+	if len(r.scopes) == 0 {
+		if r.globals[name] {
+			r.error(ident, "'%s' already declared", name)
+		}
+		r.globals[name] = true
+		ident.Local = false
+		return
+	}
+	s := r.scopes[len(r.scopes)-1]
+	if _, ok := s.declared[name]; ok {
+		r.error(ident, "'%s' already declared", name)
+		return
+	}
+	index, ok := s.pending[name]
+	if !ok {
+		index = s.size
+		s.size++
+	}
+	delete(s.pending, name)
+	s.declared[name] = index
+	ident.Local, ident.Depth, ident.Index = true, 0, index
+}
+
+// local names declared later are visible only from nested functions
+func (r *Resolver) reference(ident *parser.IdentifierLiteral) {
+	name := ident.Value
+	depth := 0
+	crossed := false
+	later := false
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		s := r.scopes[i]
+		if index, ok := s.declared[name]; ok {
+			ident.Local, ident.Depth, ident.Index = true, depth, index
+			return
+		}
+		if index, ok := s.pending[name]; ok {
+			if crossed {
+				ident.Local, ident.Depth, ident.Index = true, depth, index
+				return
+			}
+			later = true
+		}
+		if s.function {
+			crossed = true
+		}
+		depth++
+	}
+
+	ident.Local = false
+	switch {
+	case r.globals[name],
+		r.functions > 0 && r.topLevel[name],
+		r.known(name):
+	case later, r.topLevel[name]:
+		r.error(ident, "'%s' used before declaration", name)
+	case r.starImport:
+	default:
+		r.error(ident, "undefined variable '%s'", name)
+	}
+}
+
+func (r *Resolver) prescan(stmts []parser.Statement) {
+	s := r.scopes[len(r.scopes)-1]
+	for _, stmt := range stmts {
+		decl, ok := stmt.(*parser.Declaration)
+		if !ok {
+			continue
+		}
+		if _, ok := s.pending[decl.Identifier.Value]; ok {
+			continue
+		}
+		if _, ok := s.declared[decl.Identifier.Value]; ok {
+			continue
+		}
+		s.pending[decl.Identifier.Value] = s.size
+		s.size++
+	}
+}
+
+func (r *Resolver) prescanTopLevel(stmts []parser.Statement) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *parser.Declaration:
+			r.topLevel[stmt.Identifier.Value] = true
+		case *parser.ExportStatement:
+			if stmt.Declaration != nil {
+				r.topLevel[stmt.Declaration.Identifier.Value] = true
+			}
+		case *parser.ImportStatement:
+			if stmt.Alias != nil {
+				r.topLevel[stmt.Alias.Value] = true
+			} else if stmt.Names != nil {
+				for _, name := range stmt.Names {
+					r.topLevel[name.Alias.Value] = true
+				}
+			} else {
+				r.starImport = true
+			}
+		}
+	}
+}
+
+/* == utility =============================================================== */
+
+func (r *Resolver) push(function bool) *scope {
+	s := newScope(function)
+	r.scopes = append(r.scopes, s)
+	return s
+}
+
+func (r *Resolver) pop() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func (r *Resolver) error(node parser.Node, message string, a ...any) {
+	r.errors = append(r.errors, &parser.Error{
+		Message:  fmt.Sprintf(message, a...),
+		Position: node.Span().Start,
+	})
+}
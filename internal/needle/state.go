@@ -1,56 +1,198 @@
 package needle
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"needle/internal/needle/evaluator"
 	"needle/internal/needle/lexer"
 	"needle/internal/needle/parser"
+	"needle/internal/needle/resolver"
+	"strings"
 )
 
+// ErrUndefined is returned by Call for names not defined in script
+var ErrUndefined = errors.New("undefined")
+
+// SyntaxError carries every diagnostic of source that failed to parse or
+// resolve, Stage is "parse" or "resolve"
+type SyntaxError struct {
+	File        string
+	Stage       string
+	Diagnostics []*parser.Error
+}
+
+func (e *SyntaxError) Error() string {
+	file := e.File
+	if file == "" {
+		file = "<input>"
+	}
+	lines := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		lines[i] = fmt.Sprintf("%s: %s error: %s", file, e.Stage, d)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *SyntaxError) Unwrap() []error {
+	errs := make([]error, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		errs[i] = d
+	}
+	return errs
+}
+
 type Needle struct {
-	ev   *evaluator.Evaluator
-	glob *evaluator.Env
+	ev *evaluator.Evaluator
 }
 
 func New() *Needle {
-	glob := evaluator.NewEnv(nil)
 	return &Needle{
-		ev:   evaluator.New(),
-		glob: glob,
+		ev: evaluator.New(),
 	}
 }
 
-func LoadBuiltin(n *Needle) {
-	evaluator.LoadBuiltins(n.ev)
+// LoadBuiltin declares modules of pure profile: core, math, string, json, random
+func LoadBuiltin(n *Needle) error {
+	return evaluator.LoadBuiltins(n.ev)
+}
+
+// LoadModules declares named builtin modules, see evaluator.MODULE_*,
+// fs needs SetFSRoot first
+func (n *Needle) LoadModules(names ...string) error {
+	return n.ev.LoadModules(names...)
 }
 
+// SetFSRoot confines fs module to dir
+func (n *Needle) SetFSRoot(dir string) error {
+	return n.ev.SetFSRoot(dir)
+}
+
+// LoadFunction declares native function visible to script and its
+// modules, arity -1 accepts any number of arguments
 func (n *Needle) LoadFunction(
 	name string,
 	f evaluator.NativeFunction,
 	arity int,
 ) {
-	nf := &evaluator.Function{
+	n.ev.SetBuiltin(name, &evaluator.Function{
 		FType:  evaluator.F_NATIVE,
+		Name:   name,
 		Native: coverNative(f, arity),
+	})
+}
+
+// LoadFunctionParams declares native function binding arguments to params
+// like script functions: defaults, rest array, named and spread arguments
+func (n *Needle) LoadFunctionParams(
+	name string,
+	f evaluator.NativeFunction,
+	params ...evaluator.Param,
+) {
+	fun := evaluator.NewNative(f, params...)
+	fun.Name = name
+	n.ev.SetBuiltin(name, fun)
+}
+
+// LoadGoFunction declares Go func converted by NewFunction
+func (n *Needle) LoadGoFunction(name string, f any) error {
+	fun, err := NewFunction(f)
+	if err != nil {
+		return fmt.Errorf("load function '%s': %w", name, err)
+	}
+	fun.Name = name
+	n.ev.SetBuiltin(name, fun)
+	return nil
+}
+
+// SetGlobal declares or replaces global variable of script
+func (n *Needle) SetGlobal(name string, value evaluator.Value) {
+	n.ev.SetGlobal(name, value)
+}
+
+// GetGlobal returns global variable of script or builtin
+func (n *Needle) GetGlobal(name string) (evaluator.Value, bool) {
+	return n.ev.Global(name)
+}
+
+// Call calls global function of script, exception thrown by it is
+// returned as *evaluator.Exception
+func (n *Needle) Call(
+	name string,
+	args ...evaluator.Value,
+) (evaluator.Value, error) {
+	callee, ok := n.ev.Global(name)
+	if !ok {
+		return nil, fmt.Errorf("call '%s': %w", name, ErrUndefined)
 	}
-	n.glob.Declare(name, nf)
+	return n.ev.Call(callee, args...)
+}
+
+// SetOutput redirects output of say, os.Stdout by default
+func (n *Needle) SetOutput(w io.Writer) {
+	n.ev.SetOutput(w)
+}
+
+// SetInput redirects io.read_line
+func (n *Needle) SetInput(r io.Reader) {
+	n.ev.SetInput(r)
+}
+
+// SetSearchPath sets directories used to resolve imports
+func (n *Needle) SetSearchPath(paths ...string) {
+	n.ev.SetSearchPath(paths)
+}
+
+// SetBackend selects tree-walking or bytecode execution
+func (n *Needle) SetBackend(backend evaluator.Backend) {
+	n.ev.SetBackend(backend)
+}
+
+// SetLimits bounds steps, call depth and memory of each run or call
+func (n *Needle) SetLimits(limits evaluator.Limits) {
+	n.ev.SetLimits(limits)
 }
 
+// RunString runs source, invalid source is reported as *SyntaxError and
+// uncaught exception as *evaluator.Exception
 func (n *Needle) RunString(source string) error {
-	script, errs := createAST([]byte(source))
-	for _, err := range errs {
-		fmt.Println(err)
+	return n.RunStringContext(context.Background(), source)
+}
+
+// RunStringContext runs source like RunString, aborting when ctx is done
+// with exception wrapping ctx error
+func (n *Needle) RunStringContext(ctx context.Context, source string) error {
+	script, err := n.createAST(source)
+	if err != nil {
+		return err
 	}
+	return n.ev.RunContext(ctx, script)
+}
+
+func (n *Needle) createAST(source string) (*parser.Script, error) {
+	lx := lexer.New([]rune(source))
+	script, errs := parser.New(lx).Parse()
 	if errs != nil {
-		return errors.New("compile error")
+		return nil, syntaxError(script.File, "parse", errs)
+	}
+	script.Source = source
+	if errs := resolver.New(n.ev.Defined).Resolve(script); errs != nil {
+		return nil, syntaxError(script.File, "resolve", errs)
 	}
-	return n.ev.Run(script)
+	return script, nil
 }
 
-func createAST(source []byte) (*parser.Script, []error) {
-	lx := lexer.New([]rune(string(source)))
-	return parser.New(lx).Parse()
+func syntaxError(file, stage string, errs []error) *SyntaxError {
+	diagnostics := make([]*parser.Error, 0, len(errs))
+	for _, err := range errs {
+		var d *parser.Error
+		if !errors.As(err, &d) {
+			d = &parser.Error{Message: err.Error()}
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return &SyntaxError{File: file, Stage: stage, Diagnostics: diagnostics}
 }
 
 func coverNative(f evaluator.NativeFunction, a int) evaluator.NativeFunction {
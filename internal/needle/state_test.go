@@ -0,0 +1,147 @@
+package needle_test
+
+import (
+	"bytes"
+	"errors"
+	"needle/internal/needle"
+	"needle/internal/needle/evaluator"
+	"needle/internal/needle/parser"
+	"strings"
+	"testing"
+)
+
+func newNeedle(out *bytes.Buffer) *needle.Needle {
+	n := needle.New()
+	if err := needle.LoadBuiltin(n); err != nil {
+		panic(err)
+	}
+	n.SetOutput(out)
+	return n
+}
+
+var backends = []evaluator.Backend{
+	evaluator.BACKEND_TREE,
+	evaluator.BACKEND_VM,
+}
+
+// runs test on fresh needle with builtins for every backend
+func forEachBackend(t *testing.T, test func(t *testing.T, n *needle.Needle)) {
+	for _, backend := range backends {
+		t.Run(string(backend), func(t *testing.T) {
+			n := needle.New()
+			if err := needle.LoadBuiltin(n); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			n.SetBackend(backend)
+			test(t, n)
+		})
+	}
+}
+
+func TestHostFunction(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, n *needle.Needle) {
+		var out bytes.Buffer
+		n.SetOutput(&out)
+		n.LoadFunction("double", func(
+			e *evaluator.Evaluator,
+			this evaluator.Value,
+			args ...evaluator.Value,
+		) evaluator.Value {
+			return &evaluator.Number{Value: args[0].(*evaluator.Number).Value * 2}
+		}, 1)
+		n.SetGlobal("base", &evaluator.Number{Value: 20})
+
+		if err := n.RunString("var x = double(base + 1); say x;"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if out.String() != "42\n" {
+			t.Errorf("wrong output %q", out.String())
+		}
+		x, ok := n.GetGlobal("x")
+		if !ok || x.(*evaluator.Number).Value != 42 {
+			t.Errorf("wrong global x")
+		}
+	})
+}
+
+func TestCall(t *testing.T) {
+	var out bytes.Buffer
+	n := newNeedle(&out)
+	err := n.RunString(`
+var add = fun(a, b) { return a + b; };
+var fail = fun() { throw "boom"; };
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	v, err := n.Call("add", &evaluator.Number{Value: 1}, &evaluator.Number{Value: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.(*evaluator.Number).Value != 3 {
+		t.Errorf("wrong result %s", v.Say())
+	}
+
+	_, err = n.Call("fail")
+	var exc *evaluator.Exception
+	if !errors.As(err, &exc) || exc.Message != "boom" {
+		t.Errorf("expected exception, got %v", err)
+	}
+
+	_, err = n.Call("missing")
+	if !errors.Is(err, needle.ErrUndefined) {
+		t.Errorf("expected undefined error, got %v", err)
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	var out bytes.Buffer
+	n := newNeedle(&out)
+	err := n.RunString("var = 1;\nsay (;\n")
+	var syntaxErr *needle.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("expected syntax error, got %v", err)
+	}
+	if syntaxErr.Stage != "parse" || len(syntaxErr.Diagnostics) != 2 {
+		t.Errorf("wrong diagnostics: %v", err)
+	}
+	if line := syntaxErr.Diagnostics[1].Position.Line; line != 2 {
+		t.Errorf("wrong line %d", line)
+	}
+
+	err = n.RunString("say y;")
+	if !errors.As(err, &syntaxErr) || syntaxErr.Stage != "resolve" {
+		t.Errorf("expected resolve error, got %v", err)
+	}
+
+	err = n.RunString("say \"a\\q\";\nsay \"x ${1 +}\";\nsay 1;")
+	if !errors.As(err, &syntaxErr) || len(syntaxErr.Diagnostics) != 2 {
+		t.Fatalf("expected two diagnostics, got %v", err)
+	}
+	d := syntaxErr.Diagnostics[1]
+	if d.Position != (parser.Position{Line: 2, Column: 13}) || d.AtEOF {
+		t.Errorf("wrong interpolation error %+v", d)
+	}
+	if out.Len() != 0 {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestRedeclarePosition(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, n *needle.Needle) {
+		var out bytes.Buffer
+		n.SetOutput(&out)
+		if err := n.RunString("var x = 1;"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		err := n.RunString("say 2;\nvar x = 2;")
+		var exc *evaluator.Exception
+		if !errors.As(err, &exc) {
+			t.Fatalf("expected exception, got %v", err)
+		}
+		if !strings.HasPrefix(err.Error(), "<input>:2:5: ") {
+			t.Errorf("wrong position: %v", err)
+		}
+	})
+}
@@ -7,6 +7,8 @@ import (
 
 var ErrEmpty = errors.New("empty")
 
+const minShrinkCap = 64
+
 type Stack[T any] struct {
 	stack []T
 }
@@ -28,14 +30,24 @@ func (s *Stack[T]) Pop() (T, error) {
 	}
 	value := s.stack[len(s.stack)-1]
 	s.stack = s.stack[:len(s.stack)-1]
-	if len(s.stack) <= cap(s.stack) {
-		n := make([]T, len(s.stack)+int(len(s.stack)/4))
+	// small stacks keep capacity, shrinking them on every pop of a
+	// push/pop pair would reallocate each time
+	if cap(s.stack) > minShrinkCap && len(s.stack) <= cap(s.stack)/4 {
+		n := make([]T, len(s.stack), len(s.stack)*2)
 		copy(n, s.stack)
 		s.stack = n
 	}
 	return value, nil
 }
 
+func (s *Stack[T]) Peek() (T, error) {
+	if len(s.stack) == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return s.stack[len(s.stack)-1], nil
+}
+
 func (s *Stack[T]) Length() int {
 	return len(s.stack)
 }
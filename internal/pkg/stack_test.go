@@ -34,6 +34,17 @@ func TestStack(t *testing.T) {
 		t.Errorf("wrong stack length")
 	}
 
+	v, err = s.Peek()
+	if *v != 2 {
+		t.Errorf("wrong peek value")
+	}
+	if err != nil {
+		t.Errorf("unexpected error")
+	}
+	if s.Length() != 2 {
+		t.Errorf("wrong stack length")
+	}
+
 	v, err = s.Pop()
 	if *v != 2 {
 		t.Errorf("wrong pop value")
@@ -1,5 +1,10 @@
 package pkg
 
+import (
+	"strings"
+	"unicode"
+)
+
 func ShortString(str string, length int) string {
 	runeStr := []rune(str)
 	if length < len(runeStr) {
@@ -8,6 +13,25 @@ func ShortString(str string, length int) string {
 	return str
 }
 
+// SnakeCase converts Go identifier like StackTrace or UserID to
+// stack_trace or user_id
+func SnakeCase(name string) string {
+	runes := []rune(name)
+	var str strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// word starts after lower letter or at last capital of acronym
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) ||
+				i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				str.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		str.WriteRune(r)
+	}
+	return str.String()
+}
+
 func SliceMap[T any, R any](s []T, f func(T) (R, error)) ([]R, error) {
 	n := []R{}
 	for _, e := range s {
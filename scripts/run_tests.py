@@ -3,8 +3,9 @@ import subprocess
 import pathlib
 import re
 
-TEMP_NAME = "__test_build.exe"
+TEMP_NAME = os.path.abspath("__test_build.exe")
 TEST_FOLDER = "tests"
+BACKENDS = ["tree", "vm"]
 
 os.system(f"go build -o {TEMP_NAME} .")
 
@@ -21,32 +22,37 @@ def read_expected(file: pathlib.Path) -> list[str]:
 
 try:
     ok_flag = True
-    for file in pathlib.Path(TEST_FOLDER).rglob("*.ndl"):
+    for backend, file in (
+        (backend, file)
+        for backend in BACKENDS
+        for file in pathlib.Path(TEST_FOLDER).rglob("*.ndl")
+    ):
         expected = read_expected(file)
         result = subprocess.run(
-            [TEMP_NAME, file],
+            [TEMP_NAME, "run", file],
             capture_output=True,
             text=True,
+            env={**os.environ, "NEEDLE_BACKEND": backend},
         )
-        if result.stderr != "":
+        name = f"[{backend}] {file}"
+        if result.returncode != 0 or result.stderr != "":
             ok_flag = False
-            print(file, "-> EXCEPTION:", result.stderr)
+            print(name, "-> EXCEPTION:", result.stderr)
             break
         out = result.stdout.splitlines()
-        start, end = out.index("== Output =="), out.index("== Results ==")
-        if out[start + 1 : end] == expected:
-            print(file, "-> OK")
+        if out == expected:
+            print(name, "-> OK")
         else:
             ok_flag = False
-            if len(out[start + 1 : end]) != len(expected):
+            if len(out) != len(expected):
                 print(
-                    file,
-                    f"-> ERROR: want {len(expected)} lines, got {len(out[start + 1 : end])}",
+                    name,
+                    f"-> ERROR: want {len(expected)} lines, got {len(out)}",
                 )
                 continue
-            for i, line in enumerate(out[start + 1 : end]):
+            for i, line in enumerate(out):
                 if line != expected[i]:
-                    print(file, f"-> ERROR: expected {expected[i]}, got {line}")
+                    print(name, f"-> ERROR: expected {expected[i]}, got {line}")
 
     print("=" * 16)
     print("OK!" if ok_flag else "ERROR!")